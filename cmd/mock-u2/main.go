@@ -0,0 +1,81 @@
+// Command mock-u2 serves a mock of the U2 key API, e.g. to reproduce bug
+// reports. Point the tool at it with -api-url http://127.0.0.1:8000.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"github.com/i0range/U2KeyResetTool/u2test"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	var notFound, rateLimitErrors, invalidParams, errorHashes stringList
+	listen := flag.String("listen", "127.0.0.1:8000", "Address to listen on")
+	apiKey := flag.String("k", "", "Only accept this API key, any key if empty")
+	unavailable := flag.Int("unavailable", 0, "Answer the first requests with 503")
+	rateLimited := flag.Int("rate-limited", 0, "Answer the requests after -unavailable with 429")
+	retryAfter := flag.Duration("retry-after", 0, "Retry-After sent with 503 and 429")
+	flag.Var(&notFound, "not-found", "Answer this info hash with torrent not found, can be repeated")
+	flag.Var(&rateLimitErrors, "rate-limit-error", "Answer this info hash with rate limit exceeded, can be repeated")
+	flag.Var(&invalidParams, "invalid-params", "Answer this info hash with invalid params, can be repeated")
+	flag.Var(&errorHashes, "error", "Answer this info hash with an internal error, can be repeated")
+	shuffle := flag.Bool("shuffle", false, "Return the responses of a batch out of order")
+	drop := flag.Int("drop", 0, "Leave out every n-th response of a batch")
+	extra := flag.Bool("extra", false, "Add a response with an unknown id to every batch")
+	delay := flag.Duration("delay", 0, "Wait this long before each response")
+	maxBatchSize := flag.Int("max-batch", 0, "Reject batches larger than this")
+	flag.Parse()
+
+	config := u2test.Config{
+		ApiKey:       *apiKey,
+		Unavailable:  *unavailable,
+		RateLimited:  *rateLimited,
+		RetryAfter:   *retryAfter,
+		Errors:       make(map[string]u2.U2Error),
+		Shuffle:      *shuffle,
+		Drop:         *drop,
+		Extra:        *extra,
+		Delay:        *delay,
+		MaxBatchSize: *maxBatchSize,
+	}
+	for _, hash := range notFound {
+		config.Errors[hash] = u2test.NotFoundError
+	}
+	for _, hash := range rateLimitErrors {
+		config.Errors[hash] = u2test.RateLimitedError
+	}
+	for _, hash := range invalidParams {
+		config.Errors[hash] = u2test.InvalidParamsError
+	}
+	for _, hash := range errorHashes {
+		config.Errors[hash] = u2.U2Error{Code: u2.CodeInternalError, Message: "Internal error"}
+	}
+
+	handler := u2test.NewHandler(config)
+	fmt.Printf("Mock U2 API listening on http://%s\n", *listen)
+	err := http.ListenAndServe(*listen, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		handler.ServeHTTP(w, r)
+		fmt.Printf("%s %s %s in %s\n", start.Format("15:04:05"), r.Method, r.URL.Path, time.Since(start).Round(time.Millisecond))
+	}))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
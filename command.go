@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/tool"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"os"
+	"time"
+)
+
+const discoverTimeout = 3 * time.Second
+
+var commands = map[string]func(args []string){
+	"discover": discoverCommand,
+	"import":   importCommand,
+	"keys":     keysCommand,
+}
+
+func runCommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		return false
+	}
+	command(os.Args[2:])
+	return true
+}
+
+func discoverCommand(args []string) {
+	flagSet := flag.NewFlagSet("discover", flag.ExitOnError)
+	host := flagSet.String("h", "127.0.0.1", "Host to probe")
+	_ = flagSet.Parse(args)
+
+	fmt.Printf("Searching torrent clients on %s...\n", *host)
+	setupFromFound(u2.Discover(*host, discoverTimeout))
+}
+
+func importCommand(args []string) {
+	flagSet := flag.NewFlagSet("import", flag.ExitOnError)
+	target := flagSet.String("t", "", "Target program of the config file, t for Transmission, q for qBittorrent, d for Deluge")
+	file := flagSet.String("f", "", "Client config file, searched at the default locations if empty")
+	_ = flagSet.Parse(args)
+
+	if *file == "" {
+		fmt.Println("Reading torrent client config files...")
+		setupFromFound(u2.ImportConfigs())
+		return
+	}
+
+	config, err := u2.ImportConfig(tool.ParseTarget(*target), *file)
+	if err != nil {
+		fmt.Printf("Error while importing %s!\n", *file)
+		panic(err)
+	}
+	setupFromFound([]u2.Config{*config})
+}
+
+func keysCommand(args []string) {
+	usage := func() {
+		tool.TurnOnSilentMode()
+		fmt.Println("Usage: keys export -o keys.csv | keys import -f keys.csv [-add-missing]")
+	}
+	if len(args) == 0 {
+		usage()
+		return
+	}
+
+	flagSet := flag.NewFlagSet("keys "+args[0], flag.ExitOnError)
+	connectionUrl := flagSet.String("url", "", "Connection URL of the client, the saved config is used if empty")
+	switch args[0] {
+	case "export":
+		output := flagSet.String("o", "u2keys.csv", "File to write, JSON when it ends with .json, CSV otherwise")
+		_ = flagSet.Parse(args[1:])
+		tool.TurnOnSilentMode()
+		tool.InitLocalClient(keysConfig(*connectionUrl))
+		tool.ExportKeys(*output)
+	case "import":
+		input := flagSet.String("f", "u2keys.csv", "Key file to apply, JSON when it ends with .json, CSV otherwise")
+		addMissing := flagSet.Bool("add-missing", false, "Also add the U2 tracker to listed torrents without it")
+		_ = flagSet.Parse(args[1:])
+		tool.TurnOnSilentMode()
+		tool.InitLocalClient(keysConfig(*connectionUrl))
+		tool.ImportKeys(*input, *addMissing)
+	default:
+		usage()
+	}
+}
+
+// keysConfig connects to connectionUrl with the other settings of the saved
+// config, or to the client of the saved config.
+func keysConfig(connectionUrl string) *u2.Config {
+	config := readConfig(false)
+	if connectionUrl == "" {
+		if config == nil {
+			panic(fmt.Errorf("no saved config in %s, pass -url", configFileName))
+		}
+		return config
+	}
+	urlConfig, err := u2.ParseConnectionUrl(connectionUrl, "")
+	if err != nil {
+		fmt.Printf("Invalid connection URL %s!\n", connectionUrl)
+		panic(err)
+	}
+	if config != nil {
+		urlConfig.ClientProxy = config.ClientProxy
+		urlConfig.TLS = config.TLS
+		urlConfig.TrackerRules = config.TrackerRules
+		urlConfig.Metadata = config.Metadata
+		urlConfig.Announce = config.Announce
+	}
+	return urlConfig
+}
+
+func setupFromFound(found []u2.Config) {
+	if len(found) == 0 {
+		fmt.Println("No torrent client found!")
+		return
+	}
+	reader := bufio.NewReader(os.Stdin)
+	printFound(found)
+	config := chooseFound(reader, found)
+	if config == nil {
+		return
+	}
+	config = runWizard(reader, config)
+	saveConfig(config)
+	fmt.Printf("Config saved to %s, run again to reset keys.\n", configFileName)
+}
+
+// findLocalClients combines the client config files on this machine with the
+// clients answering on host. Imported entries win since they carry the user.
+func findLocalClients(host string) []u2.Config {
+	fmt.Println("Searching torrent clients on this machine...")
+	found := u2.ImportConfigs()
+	visited := make(map[string]bool)
+	for _, config := range found {
+		visited[fmt.Sprintf("%s|%d", config.Target, config.Port)] = true
+	}
+	for _, config := range u2.Discover(host, discoverTimeout) {
+		if !visited[fmt.Sprintf("%s|%d", config.Target, config.Port)] {
+			found = append(found, config)
+		}
+	}
+	if len(found) == 0 {
+		fmt.Println("No torrent client found!")
+	} else {
+		printFound(found)
+	}
+	return found
+}
+
+func printFound(found []u2.Config) {
+	for i, config := range found {
+		fmt.Printf("%d) %s\n", i+1, config.ConnectionUrl())
+	}
+}
+
+func chooseFound(reader *bufio.Reader, found []u2.Config) *u2.Config {
+	choice := askValue(reader, "Use client (0 to skip)", "1", func(value string) (string, error) {
+		var index int
+		if _, err := fmt.Sscan(value, &index); err != nil || index < 0 || index > len(found) {
+			return value, fmt.Errorf("please choose between 0 and %d", len(found))
+		}
+		return value, nil
+	})
+
+	var index int
+	_, _ = fmt.Sscan(choice, &index)
+	if index == 0 {
+		return nil
+	}
+	config := found[index-1]
+	return &config
+}
@@ -1,47 +1,79 @@
 package deluge
 
 import (
+	"crypto/tls"
 	"fmt"
-	deluge "github.com/gdm85/go-libdeluge"
 	"github.com/i0range/U2KeyResetTool/u2"
+	"net"
 	"strings"
 	"time"
 )
 
+const rpcTimeout = 60 * time.Second
+
 type Driver struct {
 }
 
 func (d Driver) NewClient(config *u2.Config) (u2.DriverClient, error) {
+	if config.BasePath != "" {
+		return nil, fmt.Errorf("deluge daemon does not support a base path, got %q", config.BasePath)
+	}
+	if config.TLS.CertFile != "" {
+		return nil, fmt.Errorf("deluge daemon does not support client certificates")
+	}
+	// The daemon speaks its own protocol over TCP, so HTTP proxy environment
+	// variables do not apply and an explicit proxy cannot be honored.
+	if config.ClientProxy != "" && config.ClientProxy != u2.ProxyDirect {
+		return nil, fmt.Errorf("deluge daemon does not support connecting through a proxy")
+	}
 	return &DriverClient{
 		config: config,
-		client: makeClient(config),
 	}, nil
 }
 
-func makeClient(config *u2.Config) *deluge.Client {
-	client := deluge.NewV1(deluge.Settings{
-		Hostname:             config.Host,
-		Port:                 uint(config.Port),
-		Login:                config.User,
-		Password:             config.Pass,
-		ReadWriteTimeout:     60 * time.Second,
-		DebugServerResponses: false,
-	})
-	return client
+func (d Driver) DefaultPort() uint16 {
+	return 58846
+}
+
+// verifyServer checks the daemon certificate with the configured CA or pinned
+// fingerprint. go-libdeluge always skips verification since Deluge generates a
+// self-signed certificate, so the check runs on a separate handshake.
+func verifyServer(config *u2.Config) error {
+	if !config.TLS.HasVerification() {
+		return nil
+	}
+	tlsConfig, err := config.TLS.Build()
+	if err != nil {
+		return err
+	}
+	tlsConfig.ServerName = config.Host
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", config.Address(), tlsConfig)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
 }
 
 type DriverClient struct {
 	config *u2.Config
-	client *deluge.Client
+	rpc    *rpcConn
+
+	// torrents keeps the status of the last GetTorrentList for
+	// GetUntrackedTorrents.
+	torrents map[string]map[string]interface{}
 }
 
 func (c *DriverClient) Check() (bool, error) {
-	err := c.client.Connect()
+	if err := verifyServer(c.config); err != nil {
+		fmt.Printf("Error while verifying Deluge certificate %s!\n", c.config.Address())
+		return false, err
+	}
+	rpc, err := c.getRpc()
 	if err != nil {
-		fmt.Printf("Error while connecting to Deluge %s %d as user %s!\n", c.config.Host, c.config.Port, c.config.User)
+		fmt.Printf("Error while connecting to Deluge %s as user %s!\n", c.config.Address(), c.config.User)
 		return false, err
 	}
-	version, err := c.client.DaemonVersion()
+	version, err := rpc.daemonVersion()
 	if err != nil {
 		fmt.Println("Error while reading Deluge version!")
 		return false, err
@@ -50,31 +82,152 @@ func (c *DriverClient) Check() (bool, error) {
 	return true, nil
 }
 
-func (c *DriverClient) GetTorrentList(tracker string) *[]u2.Torrent {
-	torrents, err := c.client.TorrentsStatus("", []string{})
+type TorrentInfo struct {
+	Name     string
+	Trackers []tracker
+}
+
+// torrentKeys are the status keys read for every torrent. The label comes
+// from the Label plugin and is missing when the plugin is disabled.
+var torrentKeys = []string{"name", "trackers", "label", "state", "save_path", "total_size", "time_added", "total_uploaded", "upload_payload_rate"}
+
+func newTorrent(hash string, status map[string]interface{}) u2.Torrent {
+	torrentInfo := TorrentInfo{
+		Name:     toString(status["name"]),
+		Trackers: parseTrackers(status["trackers"]),
+	}
+	u2Torrent := u2.Torrent{
+		Hash:     hash,
+		ExtInfo:  torrentInfo,
+		Name:     torrentInfo.Name,
+		Category: toString(status["label"]),
+		State:    torrentState(toString(status["state"])),
+		SavePath: toString(status["save_path"]),
+		Size:     toInt(status["total_size"]),
+
+		Uploaded:   toInt(status["total_uploaded"]),
+		UploadRate: int64(toFloat(status["upload_payload_rate"])),
+	}
+	if added := toFloat(status["time_added"]); added > 0 {
+		u2Torrent.AddedTime = time.Unix(int64(added), 0)
+	}
+	return u2Torrent
+}
+
+func torrentState(state string) string {
+	switch state {
+	case "Downloading", "Allocating":
+		return u2.StateDownloading
+	case "Seeding":
+		return u2.StateSeeding
+	case "Paused":
+		return u2.StatePaused
+	case "Checking", "Moving":
+		return u2.StateChecking
+	case "Queued":
+		return u2.StateQueued
+	case "Error":
+		return u2.StateError
+	}
+	return u2.StateUnknown
+}
+
+func (c *DriverClient) GetTorrentList(matcher *u2.TrackerMatcher) *[]u2.Torrent {
+	torrents := c.getTorrents()
+	c.torrents = torrents
+
+	var finalTorrents []u2.Torrent
+	for hash, status := range torrents {
+		u2Torrent := newTorrent(hash, status)
+		for _, torrentTracker := range u2Torrent.ExtInfo.(TorrentInfo).Trackers {
+			if matcher.Match(torrentTracker.Url) {
+				// Deluge only keeps the status of the tracker it announced to
+				// last, e.g. "Error: unregistered torrent".
+				trackerStatus := toString(status["tracker_status"])
+				u2Torrent.Tracker = torrentTracker.Url
+				u2Torrent.TrackerMessage = trackerStatus
+				u2Torrent.TrackerFailed = strings.HasPrefix(trackerStatus, "Error")
+				finalTorrents = append(finalTorrents, u2Torrent)
+				break
+			}
+		}
+	}
+
+	fmt.Printf("Found %d torrent(s) from Deluge!\n", len(finalTorrents))
+	return &finalTorrents
+}
+
+// getTorrents reads the status keys of both GetTorrentList and
+// GetUntrackedTorrents in one call.
+func (c *DriverClient) getTorrents() map[string]map[string]interface{} {
+	rpc, err := c.getRpc()
+	if err != nil {
+		fmt.Println("Error while connecting to Deluge!")
+		panic(err)
+	}
+	keys := append(append([]string{}, torrentKeys...), "tracker_status", "comment")
+	torrents, err := rpc.torrentsStatus(keys)
 	if err != nil {
 		fmt.Println("Error while getting torrents info!")
 		fmt.Println(err)
 		panic(err)
 	}
+	return torrents
+}
 
-	var finalTorrents []u2.Torrent
-	for hash, torrent := range torrents {
-		if strings.Contains(torrent.TrackerHost, tracker) {
-			finalTorrents = append(finalTorrents, u2.Torrent{
-				Hash:    hash,
-				ExtInfo: *torrent,
-			})
-		}
+// GetUntrackedTorrents reads the comment, Deluge 1.x does not report the
+// creator. It reuses the status of the last GetTorrentList.
+func (c *DriverClient) GetUntrackedTorrents(matcher *u2.TrackerMatcher) *[]u2.TorrentMeta {
+	torrents := c.torrents
+	if torrents == nil {
+		torrents = c.getTorrents()
 	}
+	c.torrents = nil
 
-	fmt.Printf("Found %d torrent(s) from Deluge!\n", len(finalTorrents))
+	var finalTorrents []u2.TorrentMeta
+	for hash, status := range torrents {
+		u2Torrent := newTorrent(hash, status)
+		tracked := false
+		for _, torrentTracker := range u2Torrent.ExtInfo.(TorrentInfo).Trackers {
+			if matcher.Match(torrentTracker.Url) {
+				tracked = true
+				break
+			}
+		}
+		if tracked {
+			continue
+		}
+		finalTorrents = append(finalTorrents, u2.TorrentMeta{
+			Torrent: u2Torrent,
+			Comment: toString(status["comment"]),
+		})
+	}
 	return &finalTorrents
 }
 
+// EditTorrentTracker replaces the matched tracker and keeps the other tiers.
+// Without a matched tracker the new one is added as the last tier.
 func (c *DriverClient) EditTorrentTracker(torrent *u2.Torrent, newTracker string) (bool, error) {
-	realTorrent := torrent.ExtInfo.(deluge.TorrentStatus)
-	err := c.client.SetTorrentTracker(torrent.Hash, newTracker)
+	realTorrent := torrent.ExtInfo.(TorrentInfo)
+	trackers := make([]tracker, 0, len(realTorrent.Trackers)+1)
+	nextTier := int64(0)
+	for _, torrentTracker := range realTorrent.Trackers {
+		if torrent.Tracker != "" && torrentTracker.Url == torrent.Tracker {
+			torrentTracker.Url = newTracker
+		}
+		if torrentTracker.Tier >= nextTier {
+			nextTier = torrentTracker.Tier + 1
+		}
+		trackers = append(trackers, torrentTracker)
+	}
+	if torrent.Tracker == "" {
+		trackers = append(trackers, tracker{Url: newTracker, Tier: nextTier})
+	}
+
+	rpc, err := c.getRpc()
+	if err == nil {
+		err = rpc.setTrackers(torrent.Hash, trackers)
+	}
 	if err != nil {
 		fmt.Printf("Error while changing torrent %s %s\n", torrent.Hash, realTorrent.Name)
 		fmt.Println(err)
@@ -85,6 +238,27 @@ func (c *DriverClient) EditTorrentTracker(torrent *u2.Torrent, newTracker string
 	}
 }
 
+func (c *DriverClient) Close() error {
+	if c.rpc == nil {
+		return nil
+	}
+	err := c.rpc.Close()
+	c.rpc = nil
+	return err
+}
+
+func (c *DriverClient) getRpc() (*rpcConn, error) {
+	if c.rpc != nil {
+		return c.rpc, nil
+	}
+	rpc, err := dialRpc(c.config, rpcTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c.rpc = rpc
+	return rpc, nil
+}
+
 func init() {
 	u2.Register("deluge", &Driver{})
 }
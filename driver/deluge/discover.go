@@ -0,0 +1,74 @@
+package deluge
+
+import (
+	"crypto/tls"
+	"fmt"
+	deluge "github.com/gdm85/go-libdeluge"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultWebPort = 8112
+
+func (d Driver) DiscoveryPorts() []uint16 {
+	return []uint16{d.DefaultPort(), defaultWebPort}
+}
+
+// Fingerprint logs in to the daemon without credentials and expects Deluge to
+// reject the login with an RPC error. A Deluge WebUI on the web port points to
+// a daemon on the default port of the same host.
+func (d Driver) Fingerprint(host string, port uint16, timeout time.Duration) *u2.Config {
+	if port == defaultWebPort {
+		if !isDelugeWeb(host, port, timeout) {
+			return nil
+		}
+		port = d.DefaultPort()
+	}
+
+	config := &u2.Config{
+		Target: "deluge",
+		Host:   host,
+		Port:   port,
+	}
+	conn, err := net.DialTimeout("tcp", config.Address(), timeout)
+	if err != nil {
+		return nil
+	}
+	_ = conn.Close()
+
+	client := deluge.NewV1(deluge.Settings{
+		Hostname:         config.UrlHost(),
+		Port:             uint(port),
+		ReadWriteTimeout: timeout,
+	})
+	defer client.Close()
+	err = client.Connect()
+	if _, ok := err.(deluge.RPCError); err != nil && !ok {
+		return nil
+	}
+	return config
+}
+
+func isDelugeWeb(host string, port uint16, timeout time.Duration) bool {
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	for _, scheme := range []string{"http", "https"} {
+		resp, err := httpClient.Get(fmt.Sprintf("%s://%s/", scheme, net.JoinHostPort(host, strconv.Itoa(int(port)))))
+		if err != nil {
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if strings.Contains(string(body), "Deluge") {
+			return true
+		}
+	}
+	return false
+}
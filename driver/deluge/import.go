@@ -0,0 +1,86 @@
+package deluge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type coreConfig struct {
+	DaemonPort uint16 `json:"daemon_port"`
+}
+
+func (d Driver) ConfigPaths() []string {
+	var paths []string
+	if configDir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(configDir, "deluge", "core.conf"))
+	}
+	if appData := os.Getenv("APPDATA"); appData != "" {
+		paths = append(paths, filepath.Join(appData, "deluge", "core.conf"))
+	}
+	return append(paths, "/var/lib/deluge/.config/deluge/core.conf")
+}
+
+// ImportConfig reads daemon_port from core.conf and the localclient account
+// from the auth file next to it, which Deluge creates for local connections.
+func (d Driver) ImportConfig(path string) (*u2.Config, error) {
+	configBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// core.conf holds a version header object followed by the settings object.
+	var config coreConfig
+	decoder := json.NewDecoder(bytes.NewReader(configBytes))
+	for decoder.More() {
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("cannot decode %s: %v", path, err)
+		}
+	}
+
+	port := config.DaemonPort
+	if port == 0 {
+		port = d.DefaultPort()
+	}
+	u2Config := &u2.Config{
+		Target: "deluge",
+		Host:   "127.0.0.1",
+		Port:   port,
+	}
+
+	user, pass, err := readLocalClient(filepath.Join(filepath.Dir(path), "auth"))
+	if err != nil {
+		fmt.Println("Cannot read Deluge localclient credentials!")
+		fmt.Println(err)
+	} else {
+		u2Config.User = user
+		u2Config.Pass = pass
+	}
+	return u2Config, nil
+}
+
+func readLocalClient(path string) (string, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(fields) >= 2 && fields[0] == "localclient" {
+			return fields[0], fields[1], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+	return "", "", fmt.Errorf("no localclient account in %s", path)
+}
@@ -0,0 +1,216 @@
+package deluge
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/tls"
+	"fmt"
+	deluge "github.com/gdm85/go-libdeluge"
+	"github.com/gdm85/go-rencode"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"net"
+	"time"
+)
+
+const (
+	rpcResponse = 1
+	rpcError    = 2
+)
+
+// rpcConn is a minimal Deluge v1 RPC connection, the only one the driver
+// opens. go-libdeluge only requests a fixed set of status keys and always
+// replaces the whole tracker list, so its client is not used.
+type rpcConn struct {
+	conn    *tls.Conn
+	serial  int64
+	timeout time.Duration
+}
+
+func dialRpc(config *u2.Config, timeout time.Duration) (*rpcConn, error) {
+	tlsConfig, err := config.TLS.Build()
+	if err != nil {
+		return nil, err
+	}
+	if !config.TLS.HasVerification() {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	tlsConfig.ServerName = config.Host
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", config.Address(), tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	r := &rpcConn{conn: conn, timeout: timeout}
+	if _, err := r.call("daemon.login", rencode.NewList(config.User, config.Pass), rencode.Dictionary{}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rpcConn) Close() error {
+	return r.conn.Close()
+}
+
+func (r *rpcConn) call(method string, args rencode.List, kwargs rencode.Dictionary) (rencode.List, error) {
+	r.serial++
+	var request bytes.Buffer
+	zlibWriter := zlib.NewWriter(&request)
+	encoder := rencode.NewEncoder(zlibWriter)
+	if err := encoder.Encode(rencode.NewList(rencode.NewList(r.serial, method, args, kwargs))); err != nil {
+		return rencode.List{}, err
+	}
+	if err := zlibWriter.Close(); err != nil {
+		return rencode.List{}, err
+	}
+
+	_ = r.conn.SetDeadline(time.Now().Add(r.timeout))
+	if _, err := r.conn.Write(request.Bytes()); err != nil {
+		return rencode.List{}, err
+	}
+
+	zlibReader, err := zlib.NewReader(r.conn)
+	if err != nil {
+		return rencode.List{}, err
+	}
+	var response rencode.List
+	if err := rencode.NewDecoder(zlibReader).Scan(&response); err != nil {
+		return rencode.List{}, err
+	}
+
+	var messageType, serial int64
+	if err := response.Scan(&messageType, &serial); err != nil {
+		return rencode.List{}, err
+	}
+	response.Shift(2)
+	if serial != r.serial {
+		return rencode.List{}, deluge.SerialMismatchError{ExpectedID: r.serial, ReceivedID: serial}
+	}
+
+	switch messageType {
+	case rpcResponse:
+		return response, nil
+	case rpcError:
+		var errList rencode.List
+		var rpcErr deluge.RPCError
+		if err := response.Scan(&errList); err == nil {
+			_ = errList.Scan(&rpcErr.ExceptionType, &rpcErr.ExceptionMessage, &rpcErr.TraceBack)
+		}
+		return rencode.List{}, rpcErr
+	}
+	return rencode.List{}, fmt.Errorf("unexpected deluge message type %d for %s", messageType, method)
+}
+
+func (r *rpcConn) daemonVersion() (string, error) {
+	response, err := r.call("daemon.info", rencode.NewList(), rencode.Dictionary{})
+	if err != nil {
+		return "", err
+	}
+	values := response.Values()
+	if len(values) == 0 {
+		return "", fmt.Errorf("empty daemon.info response")
+	}
+	return toString(values[0]), nil
+}
+
+// torrentsStatus returns the requested status keys of every torrent by hash.
+func (r *rpcConn) torrentsStatus(keys []string) (map[string]map[string]interface{}, error) {
+	keyList := rencode.NewList()
+	for _, key := range keys {
+		keyList.Add(key)
+	}
+	response, err := r.call("core.get_torrents_status", rencode.NewList(rencode.Dictionary{}, keyList), rencode.Dictionary{})
+	if err != nil {
+		return nil, err
+	}
+
+	var torrents rencode.Dictionary
+	if err := response.Scan(&torrents); err != nil {
+		return nil, err
+	}
+	zipped, err := torrents.Zip()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]map[string]interface{}, len(zipped))
+	for hash, value := range zipped {
+		status, ok := value.(rencode.Dictionary)
+		if !ok {
+			return nil, deluge.ErrInvalidDictionaryResponse
+		}
+		fields, err := status.Zip()
+		if err != nil {
+			return nil, err
+		}
+		result[hash] = fields
+	}
+	return result, nil
+}
+
+func (r *rpcConn) setTrackers(hash string, trackers []tracker) error {
+	trackerList := rencode.NewList()
+	for _, t := range trackers {
+		var entry rencode.Dictionary
+		entry.Add("url", t.Url)
+		entry.Add("tier", t.Tier)
+		trackerList.Add(entry)
+	}
+	_, err := r.call("core.set_torrent_trackers", rencode.NewList(hash, trackerList), rencode.Dictionary{})
+	return err
+}
+
+type tracker struct {
+	Url  string
+	Tier int64
+}
+
+func parseTrackers(value interface{}) []tracker {
+	list, ok := value.(rencode.List)
+	if !ok {
+		return nil
+	}
+	var trackers []tracker
+	for _, item := range list.Values() {
+		entry, ok := item.(rencode.Dictionary)
+		if !ok {
+			continue
+		}
+		fields, err := entry.Zip()
+		if err != nil {
+			continue
+		}
+		trackers = append(trackers, tracker{
+			Url:  toString(fields["url"]),
+			Tier: toInt(fields["tier"]),
+		})
+	}
+	return trackers
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func toInt(value interface{}) int64 {
+	var result int64
+	list := rencode.NewList(value)
+	_ = list.Scan(&result)
+	return result
+}
+
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return float64(toInt(value))
+}
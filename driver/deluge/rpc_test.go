@@ -0,0 +1,147 @@
+package deluge
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/gdm85/go-rencode"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "deluge"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// fakeDaemon answers each request with handle(method, args) on one TLS
+// connection and reports the methods it saw.
+func fakeDaemon(t *testing.T, handle func(method string, args rencode.List) interface{}) (*rpcConn, chan string) {
+	serverSide, clientSide := net.Pipe()
+	server := tls.Server(serverSide, &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}})
+	methods := make(chan string, 10)
+	go func() {
+		defer server.Close()
+		for {
+			reader, err := zlib.NewReader(server)
+			if err != nil {
+				return
+			}
+			value, err := rencode.NewDecoder(reader).DecodeNext()
+			if err != nil {
+				return
+			}
+			outer, _ := value.(rencode.List)
+			var request rencode.List
+			if err := outer.Scan(&request); err != nil {
+				t.Error(err)
+				return
+			}
+			var serial int64
+			var method string
+			var args rencode.List
+			var kwargs rencode.Dictionary
+			if err := request.Scan(&serial, &method, &args, &kwargs); err != nil {
+				t.Error(err)
+				return
+			}
+			methods <- method
+
+			var response bytes.Buffer
+			writer := zlib.NewWriter(&response)
+			encoder := rencode.NewEncoder(writer)
+			_ = encoder.Encode(rencode.NewList(int64(rpcResponse), serial, handle(method, args)))
+			_ = writer.Close()
+			if _, err := server.Write(response.Bytes()); err != nil {
+				return
+			}
+		}
+	}()
+	client := tls.Client(clientSide, &tls.Config{InsecureSkipVerify: true})
+	return &rpcConn{conn: client, timeout: 5 * time.Second}, methods
+}
+
+func TestDaemonVersionAndStatus(t *testing.T) {
+	rpc, methods := fakeDaemon(t, func(method string, args rencode.List) interface{} {
+		switch method {
+		case "daemon.info":
+			return "1.3.15"
+		case "core.get_torrents_status":
+			var trackerEntry, status, torrents rencode.Dictionary
+			trackerEntry.Add("url", "https://daydream.dmhy.best/announce?secure=abc")
+			trackerEntry.Add("tier", int64(0))
+			status.Add("name", "one")
+			status.Add("trackers", rencode.NewList(trackerEntry))
+			torrents.Add("aaaa", status)
+			return torrents
+		}
+		return nil
+	})
+	defer rpc.Close()
+
+	version, err := rpc.daemonVersion()
+	if err != nil || version != "1.3.15" {
+		t.Fatalf("daemonVersion() = %q, %v", version, err)
+	}
+	torrents, err := rpc.torrentsStatus([]string{"name", "trackers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, ok := torrents["aaaa"]
+	if !ok || toString(status["name"]) != "one" {
+		t.Fatalf("torrentsStatus() = %v", torrents)
+	}
+	trackers := parseTrackers(status["trackers"])
+	if len(trackers) != 1 || trackers[0].Url != "https://daydream.dmhy.best/announce?secure=abc" {
+		t.Fatalf("parseTrackers() = %v", trackers)
+	}
+
+	for _, want := range []string{"daemon.info", "core.get_torrents_status"} {
+		if got := <-methods; got != want {
+			t.Errorf("method = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSetTrackers(t *testing.T) {
+	var got rencode.List
+	rpc, _ := fakeDaemon(t, func(method string, args rencode.List) interface{} {
+		got = args
+		return nil
+	})
+	defer rpc.Close()
+
+	err := rpc.setTrackers("aaaa", []tracker{{Url: "https://a/announce", Tier: 0}, {Url: "https://b/announce", Tier: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hash string
+	var trackerList rencode.List
+	if err := got.Scan(&hash, &trackerList); err != nil {
+		t.Fatal(err)
+	}
+	trackers := parseTrackers(trackerList)
+	if hash != "aaaa" || len(trackers) != 2 || trackers[1].Url != "https://b/announce" || trackers[1].Tier != 1 {
+		t.Fatalf("set_torrent_trackers(%q, %v)", hash, trackers)
+	}
+}
@@ -0,0 +1,56 @@
+package qBittorrent
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var webApiVersionPattern = regexp.MustCompile(`^\d+\.\d+(\.\d+)?$`)
+
+func (q Driver) DiscoveryPorts() []uint16 {
+	return []uint16{q.DefaultPort(), 8081, 8090}
+}
+
+// Fingerprint asks for the WebUI API version. It is public when auth is
+// bypassed for localhost, and is refused with a plain "Forbidden" otherwise.
+func (q Driver) Fingerprint(host string, port uint16, timeout time.Duration) *u2.Config {
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	for _, secure := range []bool{false, true} {
+		scheme := "http"
+		if secure {
+			scheme = "https"
+		}
+		resp, err := httpClient.Get(fmt.Sprintf("%s://%s/api/v2/app/webapiVersion", scheme, net.JoinHostPort(host, strconv.Itoa(int(port)))))
+		if err != nil {
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		content := strings.TrimSpace(string(body))
+		isQBittorrent := resp.StatusCode == http.StatusOK && webApiVersionPattern.MatchString(content)
+		if resp.StatusCode == http.StatusForbidden && content == "Forbidden" {
+			isQBittorrent = true
+		}
+		if isQBittorrent {
+			return &u2.Config{
+				Target: "qBittorrent",
+				Host:   host,
+				Port:   port,
+				Secure: secure,
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package qBittorrent
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func (q Driver) ConfigPaths() []string {
+	var paths []string
+	if configDir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths,
+			filepath.Join(configDir, "qBittorrent", "qBittorrent.conf"),
+			filepath.Join(configDir, "qBittorrent", "qBittorrent.ini"),
+		)
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		paths = append(paths,
+			filepath.Join(homeDir, ".config", "qBittorrent", "qBittorrent.conf"),
+			filepath.Join(homeDir, ".config", "qBittorrent", "qBittorrent.ini"),
+		)
+	}
+	return paths
+}
+
+// ImportConfig reads the WebUI settings from the [Preferences] section. The
+// password is stored as a PBKDF2 hash, so it has to be entered by the user.
+func (q Driver) ImportConfig(path string) (*u2.Config, error) {
+	preferences, err := readIniSection(path, "Preferences")
+	if err != nil {
+		return nil, err
+	}
+
+	port := q.DefaultPort()
+	if portString, ok := preferences[`WebUI\Port`]; ok {
+		parsedPort, err := strconv.ParseUint(portString, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WebUI\\Port %q in %s", portString, path)
+		}
+		port = uint16(parsedPort)
+	}
+
+	return &u2.Config{
+		Target: "qBittorrent",
+		Host:   "127.0.0.1",
+		Port:   port,
+		Secure: preferences[`WebUI\HTTPS\Enabled`] == "true",
+		User:   preferences[`WebUI\Username`],
+	}, nil
+}
+
+func readIniSection(path string, section string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	currentSection := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			currentSection = line[1 : len(line)-1]
+			continue
+		}
+		if currentSection != section {
+			continue
+		}
+		if index := strings.Index(line, "="); index > 0 {
+			values[strings.TrimSpace(line[:index])] = strings.TrimSpace(line[index+1:])
+		}
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,76 @@
+package qBittorrent
+
+import (
+	"github.com/i0range/U2KeyResetTool/u2"
+	"github.com/i0range/go-qbittorrent/pkg"
+	"strings"
+	"time"
+)
+
+// torrentItem is an entry of /torrents/info. The library model lacks the save
+// path, tags, added time and upload, so the list is decoded here.
+type torrentItem struct {
+	Hash     string `json:"hash"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	State    string `json:"state"`
+	Category string `json:"category"`
+	Tags     string `json:"tags"`
+	SavePath string `json:"save_path"`
+	AddedOn  int64  `json:"added_on"`
+	Uploaded int64  `json:"uploaded"`
+	Upspeed  int64  `json:"upspeed"`
+}
+
+func (c *DriverClient) listTorrents() ([]torrentItem, error) {
+	var torrents []torrentItem
+	err := pkg.GetInto(c.client.Torrent.Client, &torrents, c.client.Torrent.BaseUrl+"/info", nil)
+	return torrents, err
+}
+
+func (t *torrentItem) toTorrent(tracker string) u2.Torrent {
+	u2Torrent := u2.Torrent{
+		Hash:    t.Hash,
+		Tracker: tracker,
+		ExtInfo: TorrentInfo{
+			Hash:    t.Hash,
+			Name:    t.Name,
+			Tracker: tracker,
+		},
+		Name:     t.Name,
+		Category: t.Category,
+		State:    torrentState(t.State),
+		SavePath: t.SavePath,
+		Size:     t.Size,
+
+		Uploaded:   t.Uploaded,
+		UploadRate: t.Upspeed,
+	}
+	for _, tag := range strings.Split(t.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			u2Torrent.Tags = append(u2Torrent.Tags, tag)
+		}
+	}
+	if t.AddedOn > 0 {
+		u2Torrent.AddedTime = time.Unix(t.AddedOn, 0)
+	}
+	return u2Torrent
+}
+
+func torrentState(state string) string {
+	switch state {
+	case "uploading", "stalledUP", "forcedUP":
+		return u2.StateSeeding
+	case "downloading", "stalledDL", "metaDL", "forcedMetaDL", "forcedDL", "allocating":
+		return u2.StateDownloading
+	case "pausedUP", "pausedDL", "stoppedUP", "stoppedDL":
+		return u2.StatePaused
+	case "checkingUP", "checkingDL", "checkingResumeData", "moving":
+		return u2.StateChecking
+	case "queuedUP", "queuedDL":
+		return u2.StateQueued
+	case "error", "missingFiles":
+		return u2.StateError
+	}
+	return u2.StateUnknown
+}
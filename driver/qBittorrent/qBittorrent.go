@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"github.com/i0range/U2KeyResetTool/u2"
 	qBittorrent "github.com/i0range/go-qbittorrent"
+	"github.com/i0range/go-qbittorrent/pkg/model"
 	log "github.com/sirupsen/logrus"
-	"strconv"
 	"strings"
 )
 
@@ -19,15 +19,28 @@ type Driver struct {
 }
 
 func (q Driver) NewClient(config *u2.Config) (u2.DriverClient, error) {
+	client, err := makeClient(config)
+	if err != nil {
+		return nil, err
+	}
 	return &DriverClient{
 		config: config,
-		client: makeClient(config),
+		client: client,
 	}, nil
 }
 
+func (q Driver) DefaultPort() uint16 {
+	return 8080
+}
+
 type DriverClient struct {
 	config *u2.Config
 	client *qBittorrent.Client
+
+	// untracked keeps the torrents without U2 tracker found by the last
+	// GetTorrentList for GetUntrackedTorrents.
+	untracked []torrentItem
+	listed    bool
 }
 
 func (c *DriverClient) Check() (bool, error) {
@@ -39,14 +52,25 @@ func (c *DriverClient) Check() (bool, error) {
 	return true, nil
 }
 
-func (c *DriverClient) GetTorrentList(tracker string) *[]u2.Torrent {
-	torrents, err := c.client.Torrent.GetList(nil)
+func (c *DriverClient) GetTorrentList(matcher *u2.TrackerMatcher) *[]u2.Torrent {
+	finalTorrents, untracked := c.splitTorrents(matcher)
+	c.untracked, c.listed = untracked, true
+	fmt.Printf("Found %d torrent(s) from qBittorrent!\n", len(finalTorrents))
+
+	return &finalTorrents
+}
+
+// splitTorrents reads the trackers of every torrent, which costs one request
+// per torrent, and splits them by whether a tracker matches.
+func (c *DriverClient) splitTorrents(matcher *u2.TrackerMatcher) ([]u2.Torrent, []torrentItem) {
+	torrents, err := c.listTorrents()
 	if err != nil {
 		fmt.Println("Error while getting torrent list from qBittorrent!")
 		panic(err)
 	}
 
-	var u2Torrents []TorrentInfo
+	var tracked []u2.Torrent
+	var untracked []torrentItem
 	for _, torrent := range torrents {
 		trackers, err := c.client.Torrent.GetTrackers(torrent.Hash)
 		if err != nil {
@@ -54,38 +78,60 @@ func (c *DriverClient) GetTorrentList(tracker string) *[]u2.Torrent {
 			fmt.Println(err)
 			continue
 		}
-		if len(trackers) > 0 {
-			for _, torrentTracker := range trackers {
-				if strings.Contains(torrentTracker.URL, tracker) {
-					u2Torrents = append(u2Torrents, TorrentInfo{
-						Hash:    torrent.Hash,
-						Name:    torrent.Name,
-						Tracker: torrentTracker.URL,
-					})
-					break
-				}
+		found := false
+		for _, torrentTracker := range trackers {
+			if matcher.Match(torrentTracker.URL) {
+				u2Torrent := torrent.toTorrent(torrentTracker.URL)
+				u2Torrent.TrackerMessage = torrentTracker.Message
+				u2Torrent.TrackerFailed = torrentTracker.Status == model.TrackerStatusNotWorking
+				tracked = append(tracked, u2Torrent)
+				found = true
+				break
 			}
 		}
-	}
-	fmt.Printf("Found %d torrent(s) from qBittorrent!\n", len(u2Torrents))
-
-	var finalTorrents []u2.Torrent
-	if len(u2Torrents) > 0 {
-		for _, u2Torrent := range u2Torrents {
-			finalTorrents = append(finalTorrents, u2.Torrent{
-				Hash:    u2Torrent.Hash,
-				ExtInfo: u2Torrent,
-			})
+		if !found {
+			untracked = append(untracked, torrent)
 		}
 	}
+	return tracked, untracked
+}
+
+// GetUntrackedTorrents asks for the properties of every torrent without a
+// matching tracker, which costs one request per torrent. It reuses the list
+// of the last GetTorrentList.
+func (c *DriverClient) GetUntrackedTorrents(matcher *u2.TrackerMatcher) *[]u2.TorrentMeta {
+	untracked := c.untracked
+	if !c.listed {
+		_, untracked = c.splitTorrents(matcher)
+	}
+	c.untracked, c.listed = nil, false
 
+	var finalTorrents []u2.TorrentMeta
+	for _, torrent := range untracked {
+		properties, err := c.client.Torrent.GetProperties(torrent.Hash)
+		if err != nil {
+			fmt.Printf("Getting properties of torrent %s %s failed!\n", torrent.Hash, torrent.Name)
+			fmt.Println(err)
+			continue
+		}
+		finalTorrents = append(finalTorrents, u2.TorrentMeta{
+			Torrent:   torrent.toTorrent(""),
+			Comment:   properties.Comment,
+			CreatedBy: properties.CreatedBy,
+		})
+	}
 	return &finalTorrents
 }
 
 func (c *DriverClient) EditTorrentTracker(torrent *u2.Torrent, tracker string) (bool, error) {
 	realTorrent := torrent.ExtInfo.(TorrentInfo)
 
-	err := c.client.Torrent.EditTrackers(realTorrent.Hash, realTorrent.Tracker, tracker)
+	var err error
+	if realTorrent.Tracker == "" {
+		err = c.client.Torrent.AddTrackers(realTorrent.Hash, []string{tracker})
+	} else {
+		err = c.client.Torrent.EditTrackers(realTorrent.Hash, realTorrent.Tracker, tracker)
+	}
 	if err != nil {
 		fmt.Printf("Error while changing torrent %s %s\n", realTorrent.Hash, realTorrent.Name)
 		fmt.Println(err)
@@ -96,23 +142,36 @@ func (c *DriverClient) EditTorrentTracker(torrent *u2.Torrent, tracker string) (
 	}
 }
 
-func makeClient(config *u2.Config) *qBittorrent.Client {
+func (c *DriverClient) Close() error {
+	c.client.Application.Client.CloseIdleConnections()
+	return nil
+}
+
+func makeClient(config *u2.Config) (*qBittorrent.Client, error) {
 	var baseUrl string
 	if config.Secure {
 		baseUrl += "https://"
 	} else {
 		baseUrl += "http://"
 	}
-	baseUrl += config.Host + ":" + strconv.Itoa(int(config.Port))
+	baseUrl += config.Address() + strings.TrimSuffix(config.BasePath, "/")
 	client := qBittorrent.NewClient(baseUrl, log.New())
+
+	// All API groups share one http.Client, so its transport applies everywhere.
+	httpClient, err := config.ClientHTTPClient(0)
+	if err != nil {
+		return nil, err
+	}
+	client.Application.Client.Transport = httpClient.Transport
+
 	if config.User != "" {
 		err := client.Login(config.User, config.Pass)
 		if err != nil {
 			fmt.Printf("Error while connecting to qBittorrent %s\n", baseUrl)
-			panic(err)
+			return nil, err
 		}
 	}
-	return client
+	return client, nil
 }
 
 func init() {
@@ -0,0 +1,50 @@
+package transmission
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (t Driver) DiscoveryPorts() []uint16 {
+	return []uint16{t.DefaultPort()}
+}
+
+// Fingerprint relies on the RPC session handshake: Transmission answers a bare
+// request with 409 and a session id, or with 401 when RPC auth is enabled.
+func (t Driver) Fingerprint(host string, port uint16, timeout time.Duration) *u2.Config {
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	for _, secure := range []bool{false, true} {
+		scheme := "http"
+		if secure {
+			scheme = "https"
+		}
+		resp, err := httpClient.Get(fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, strconv.Itoa(int(port))), defaultRpcUri))
+		if err != nil {
+			continue
+		}
+		_ = resp.Body.Close()
+
+		isTransmission := resp.StatusCode == http.StatusConflict && resp.Header.Get("X-Transmission-Session-Id") != ""
+		if resp.StatusCode == http.StatusUnauthorized && strings.Contains(resp.Header.Get("WWW-Authenticate"), "Transmission") {
+			isTransmission = true
+		}
+		if isTransmission {
+			return &u2.Config{
+				Target: "transmission",
+				Host:   host,
+				Port:   port,
+				Secure: secure,
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package transmission
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+type settings struct {
+	RpcPort     uint16 `json:"rpc-port"`
+	RpcUrl      string `json:"rpc-url"`
+	RpcUsername string `json:"rpc-username"`
+}
+
+func (t Driver) ConfigPaths() []string {
+	var paths []string
+	if configDir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths,
+			filepath.Join(configDir, "transmission-daemon", "settings.json"),
+			filepath.Join(configDir, "transmission", "settings.json"),
+		)
+	}
+	if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
+		paths = append(paths, filepath.Join(localAppData, "transmission", "settings.json"))
+	}
+	return append(paths,
+		"/etc/transmission-daemon/settings.json",
+		"/var/lib/transmission-daemon/info/settings.json",
+		"/var/lib/transmission/.config/transmission-daemon/settings.json",
+	)
+}
+
+// ImportConfig reads settings.json. The RPC password is only stored as a
+// salted hash there, so it has to be entered by the user.
+func (t Driver) ImportConfig(path string) (*u2.Config, error) {
+	settingsBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var clientSettings settings
+	if err := json.Unmarshal(settingsBytes, &clientSettings); err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %v", path, err)
+	}
+
+	port := clientSettings.RpcPort
+	if port == 0 {
+		port = t.DefaultPort()
+	}
+	config := &u2.Config{
+		Target: "transmission",
+		Host:   "127.0.0.1",
+		Port:   port,
+		User:   clientSettings.RpcUsername,
+	}
+	if clientSettings.RpcUrl != "" && clientSettings.RpcUrl != "/transmission/" {
+		config.BasePath = clientSettings.RpcUrl
+	}
+	return config, nil
+}
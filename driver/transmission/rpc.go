@@ -0,0 +1,113 @@
+package transmission
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hekmon/transmissionrpc"
+	"net/http"
+)
+
+const (
+	defaultRpcUri = "/transmission/rpc"
+	sessionHeader = "X-Transmission-Session-Id"
+)
+
+// torrentFields are the torrent-get fields the driver reads.
+var torrentFields = []string{"id", "hashString", "name", "trackers", "trackerStats", "downloadDir", "status", "error",
+	"totalSize", "addedDate", "uploadedEver", "rateUpload", "comment", "creator", "torrentFile"}
+
+// rpcClient speaks the Transmission RPC protocol through an http.Client of our
+// own, so that the TLS and proxy settings apply. transmissionrpc v1 does not
+// accept one, its types are reused for the payloads.
+type rpcClient struct {
+	url        string
+	user       string
+	pass       string
+	httpClient *http.Client
+	sessionId  string
+}
+
+type rpcRequest struct {
+	Method    string      `json:"method"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type rpcResponse struct {
+	Arguments json.RawMessage `json:"arguments"`
+	Result    string          `json:"result"`
+}
+
+func (c *rpcClient) call(method string, arguments interface{}, result interface{}) error {
+	body, err := json.Marshal(rpcRequest{Method: method, Arguments: arguments})
+	if err != nil {
+		return err
+	}
+	resp, err := c.post(body)
+	if err == nil && resp.StatusCode == http.StatusConflict {
+		// The first request only fetches the session id.
+		c.sessionId = resp.Header.Get(sessionHeader)
+		_ = resp.Body.Close()
+		resp, err = c.post(body)
+	}
+	if err != nil {
+		return fmt.Errorf("'%s' request failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("'%s' request failed: HTTP %s", method, resp.Status)
+	}
+
+	var response rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("'%s' response does not parse: %v", method, err)
+	}
+	if response.Result != "success" {
+		return fmt.Errorf("'%s' failed: %s", method, response.Result)
+	}
+	if result != nil {
+		return json.Unmarshal(response.Arguments, result)
+	}
+	return nil
+}
+
+func (c *rpcClient) post(body []byte) (*http.Response, error) {
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(sessionHeader, c.sessionId)
+	if c.user != "" || c.pass != "" {
+		req.SetBasicAuth(c.user, c.pass)
+	}
+	return c.httpClient.Do(req)
+}
+
+// RPCVersion tells whether the server accepts the RPC version of
+// transmissionrpc.
+func (c *rpcClient) RPCVersion() (bool, int64, int64, error) {
+	var session transmissionrpc.SessionArguments
+	if err := c.call("session-get", nil, &session); err != nil {
+		return false, 0, 0, err
+	}
+	if session.RPCVersion == nil || session.RPCVersionMinimum == nil {
+		return false, 0, 0, fmt.Errorf("server did not report its RPC version")
+	}
+	return transmissionrpc.RPCVersion >= *session.RPCVersionMinimum, *session.RPCVersion, *session.RPCVersionMinimum, nil
+}
+
+func (c *rpcClient) TorrentGetAll() ([]*transmissionrpc.Torrent, error) {
+	var result struct {
+		Torrents []*transmissionrpc.Torrent `json:"torrents"`
+	}
+	arguments := map[string]interface{}{"fields": torrentFields}
+	if err := c.call("torrent-get", arguments, &result); err != nil {
+		return nil, err
+	}
+	return result.Torrents, nil
+}
+
+func (c *rpcClient) TorrentSet(payload *transmissionrpc.TorrentSetPayload) error {
+	return c.call("torrent-set", payload, nil)
+}
@@ -5,76 +5,197 @@ import (
 	"github.com/hekmon/transmissionrpc"
 	"github.com/i0range/U2KeyResetTool/u2"
 	"strings"
+	"time"
 )
 
+const httpTimeout = 30 * time.Second
+
 type Driver struct {
 }
 
+type TorrentInfo struct {
+	Torrent   transmissionrpc.Torrent
+	TrackerId int64
+}
+
 func (t Driver) NewClient(config *u2.Config) (u2.DriverClient, error) {
+	client, err := makeClient(config)
+	if err != nil {
+		return nil, err
+	}
 	return &DriverClient{
 		config: config,
-		client: makeClient(config),
+		client: client,
 	}, nil
 }
 
+func (t Driver) DefaultPort() uint16 {
+	return 9091
+}
+
 type DriverClient struct {
 	config *u2.Config
-	client *transmissionrpc.Client
+	client *rpcClient
+
+	// torrents keeps the list of the last GetTorrentList for
+	// GetUntrackedTorrents.
+	torrents []*transmissionrpc.Torrent
 }
 
 func (c *DriverClient) Check() (bool, error) {
 	ok, serverVersion, minimumVersion, err := c.client.RPCVersion()
-	if err != nil {
+	if err == nil {
 		fmt.Println("Connected to transmission server!")
 		fmt.Printf("Server version %d|Server minium version %d\n", serverVersion, minimumVersion)
 	}
 	return ok, err
 }
 
-func (c *DriverClient) GetTorrentList(tracker string) *[]u2.Torrent {
+func (c *DriverClient) GetTorrentList(matcher *u2.TrackerMatcher) *[]u2.Torrent {
+	torrents := c.getTorrents()
+	c.torrents = torrents
+
+	var finalTorrents []u2.Torrent
+	for _, torrent := range torrents {
+		for _, tracker := range torrent.Trackers {
+			if matcher.Match(tracker.Announce) {
+				u2Torrent := newTorrent(torrent, tracker.ID)
+				u2Torrent.Tracker = tracker.Announce
+				for _, stats := range torrent.TrackerStats {
+					if stats.ID == tracker.ID {
+						u2Torrent.TrackerMessage = stats.LastAnnounceResult
+						u2Torrent.TrackerFailed = stats.HasAnnounced && !stats.LastAnnounceSucceeded
+						break
+					}
+				}
+				finalTorrents = append(finalTorrents, u2Torrent)
+				break
+			}
+		}
+	}
+	fmt.Printf("Found %d torrent(s) from Transmission!\n", len(finalTorrents))
+
+	return &finalTorrents
+}
+
+func (c *DriverClient) getTorrents() []*transmissionrpc.Torrent {
 	torrents, err := c.client.TorrentGetAll()
 	if err != nil {
 		fmt.Println("Error while getting torrents list!")
 		panic(err)
 	}
+	return torrents
+}
+
+// GetUntrackedTorrents reuses the list of the last GetTorrentList.
+func (c *DriverClient) GetUntrackedTorrents(matcher *u2.TrackerMatcher) *[]u2.TorrentMeta {
+	torrents := c.torrents
+	if torrents == nil {
+		torrents = c.getTorrents()
+	}
+	c.torrents = nil
 
-	var u2Torrents []transmissionrpc.Torrent
+	var finalTorrents []u2.TorrentMeta
 	for _, torrent := range torrents {
-		if len(torrent.Trackers) > 0 && strings.Contains(torrent.Trackers[0].Announce, tracker) {
-			u2Torrents = append(u2Torrents, *torrent)
+		tracked := false
+		for _, tracker := range torrent.Trackers {
+			if matcher.Match(tracker.Announce) {
+				tracked = true
+				break
+			}
+		}
+		if tracked {
+			continue
 		}
-	}
-	fmt.Printf("Found %d torrent(s) from Transmission!\n", len(u2Torrents))
 
-	var finalTorrents []u2.Torrent
-	if len(u2Torrents) > 0 {
-		for _, u2Torrent := range u2Torrents {
-			finalTorrents = append(finalTorrents, u2.Torrent{
-				Hash:    *u2Torrent.HashString,
-				ExtInfo: u2Torrent,
-			})
+		meta := u2.TorrentMeta{
+			Torrent:   newTorrent(torrent, 0),
+			Comment:   stringValue(torrent.Comment),
+			CreatedBy: stringValue(torrent.Creator),
 		}
+		// The torrent file is only readable when running next to the daemon.
+		if torrent.TorrentFile != nil {
+			_ = meta.ReadTorrentFile(*torrent.TorrentFile)
+		}
+		finalTorrents = append(finalTorrents, meta)
 	}
-
 	return &finalTorrents
 }
 
+func newTorrent(torrent *transmissionrpc.Torrent, trackerId int64) u2.Torrent {
+	u2Torrent := u2.Torrent{
+		Hash: *torrent.HashString,
+		ExtInfo: TorrentInfo{
+			Torrent:   *torrent,
+			TrackerId: trackerId,
+		},
+		Name:     stringValue(torrent.Name),
+		State:    torrentState(torrent),
+		SavePath: stringValue(torrent.DownloadDir),
+	}
+	if torrent.TotalSize != nil {
+		u2Torrent.Size = int64(torrent.TotalSize.Byte())
+	}
+	if torrent.AddedDate != nil {
+		u2Torrent.AddedTime = *torrent.AddedDate
+	}
+	if torrent.UploadedEver != nil {
+		u2Torrent.Uploaded = *torrent.UploadedEver
+	}
+	if torrent.RateUpload != nil {
+		u2Torrent.UploadRate = *torrent.RateUpload
+	}
+	return u2Torrent
+}
+
+func torrentState(torrent *transmissionrpc.Torrent) string {
+	if torrent.Error != nil && *torrent.Error != 0 {
+		return u2.StateError
+	}
+	if torrent.Status == nil {
+		return u2.StateUnknown
+	}
+	switch *torrent.Status {
+	case transmissionrpc.TorrentStatusStopped:
+		return u2.StatePaused
+	case transmissionrpc.TorrentStatusCheckWait, transmissionrpc.TorrentStatusCheck:
+		return u2.StateChecking
+	case transmissionrpc.TorrentStatusDownloadWait, transmissionrpc.TorrentStatusSeedWait:
+		return u2.StateQueued
+	case transmissionrpc.TorrentStatusDownload:
+		return u2.StateDownloading
+	case transmissionrpc.TorrentStatusSeed:
+		return u2.StateSeeding
+	}
+	return u2.StateUnknown
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
 func (c *DriverClient) EditTorrentTracker(torrent *u2.Torrent, newTracker string) (bool, error) {
-	realTorrent := torrent.ExtInfo.(transmissionrpc.Torrent)
+	torrentInfo := torrent.ExtInfo.(TorrentInfo)
+	realTorrent := torrentInfo.Torrent
 	payload := transmissionrpc.TorrentSetPayload{
-		IDs:           []int64{*realTorrent.ID},
-		TrackerRemove: []int64{realTorrent.Trackers[0].ID},
+		IDs: []int64{*realTorrent.ID},
 	}
-	err := c.client.TorrentSet(&payload)
-	if err != nil {
-		fmt.Printf("Error while changing torrent %d %s %s\n", *realTorrent.ID, *realTorrent.HashString, *realTorrent.Name)
-		fmt.Println(err)
-		return false, err
+	if torrent.Tracker != "" {
+		payload.TrackerRemove = []int64{torrentInfo.TrackerId}
+		err := c.client.TorrentSet(&payload)
+		if err != nil {
+			fmt.Printf("Error while changing torrent %d %s %s\n", *realTorrent.ID, *realTorrent.HashString, *realTorrent.Name)
+			fmt.Println(err)
+			return false, err
+		}
 	}
 
 	payload.TrackerRemove = nil
 	payload.TrackerAdd = []string{newTracker}
-	err = c.client.TorrentSet(&payload)
+	err := c.client.TorrentSet(&payload)
 
 	if err != nil {
 		fmt.Printf("Error while changing torrent %d %s %s\n", *realTorrent.ID, *realTorrent.HashString, *realTorrent.Name)
@@ -86,17 +207,35 @@ func (c *DriverClient) EditTorrentTracker(torrent *u2.Torrent, newTracker string
 	}
 }
 
-func makeClient(config *u2.Config) *transmissionrpc.Client {
-	conf := transmissionrpc.AdvancedConfig{
-		HTTPS: config.Secure,
-		Port:  config.Port,
+func (c *DriverClient) Close() error {
+	c.client.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// rpcUri appends rpc to the base path like Transmission does to its rpc-url.
+// A base path already ending with /rpc, as saved by older versions, is kept.
+func rpcUri(basePath string) string {
+	if basePath == "" {
+		return defaultRpcUri
 	}
+	return strings.TrimSuffix(strings.TrimSuffix(basePath, "/"), "/rpc") + "/rpc"
+}
 
-	client, err := transmissionrpc.New(config.Host, config.User, config.Pass, &conf)
+func makeClient(config *u2.Config) (*rpcClient, error) {
+	httpClient, err := config.ClientHTTPClient(httpTimeout)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	scheme := "http"
+	if config.Secure {
+		scheme = "https"
 	}
-	return client
+	return &rpcClient{
+		url:        scheme + "://" + config.Address() + rpcUri(config.BasePath),
+		user:       config.User,
+		pass:       config.Pass,
+		httpClient: httpClient,
+	}, nil
 }
 
 func init() {
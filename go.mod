@@ -4,7 +4,10 @@ go 1.14
 
 require (
 	github.com/gdm85/go-libdeluge v0.5.4
+	github.com/gdm85/go-rencode v0.1.6
 	github.com/hekmon/transmissionrpc v1.1.0
 	github.com/i0range/go-qbittorrent v0.0.0-20200829122403-167ccd7e67e8
 	github.com/sirupsen/logrus v1.4.2
+	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/term v0.0.0-20220526004731-065cf7ba2467
 )
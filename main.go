@@ -18,8 +18,27 @@ func main() {
 			tool.KeepWindow(0)
 		}
 	}()
+	if runCommand() {
+		return
+	}
+
 	config := initConfig()
-	tool.InitClient(config)
+	applyRunConfig(config)
+	if *migrateTo != "" {
+		config.Announce.Host = *migrateTo
+	}
+	if len(excludeAdd) > 0 || len(excludeRemove) > 0 {
+		tool.UpdateExcludes(excludeAdd, excludeRemove)
+	}
+	if *migrateTo != "" {
+		tool.InitLocalClient(config)
+	} else {
+		tool.InitClient(config)
+	}
 	saveConfig(config)
-	tool.ProcessTorrent()
+	if *migrateTo != "" {
+		tool.MigrateTrackers(config.Announce.Host)
+	} else {
+		tool.ProcessTorrent()
+	}
 }
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/tool"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"strings"
+)
+
+// runFlags holds the names of flags that choose what to do with the client.
+// Unlike the connection flags they can be combined with the saved config.
+var runFlags = make(map[string]bool)
+
+func runFlag(name string) string {
+	runFlags[name] = true
+	return name
+}
+
+var (
+	migrateTo     = flag.String(runFlag("migrate-to"), "", "Move the announce URLs of U2 torrents to this tracker host, keeping their keys")
+	addMissing    = flag.Bool(runFlag("add-missing"), false, "Also add the U2 tracker to U2 torrents that lost it, found by -match-comment, -match-source, -match-created-by or -match-hash")
+	onlyBroken    = flag.Bool(runFlag("only-broken"), false, "Only rekey torrents whose last announce to U2 failed because of the key")
+	brokenPattern = flag.String(runFlag("broken-pattern"), "", "Regex on the announce error treated as a key error by -only-broken (default \""+u2.DefaultKeyErrorPattern+"\")")
+
+	filterNames      stringList
+	filterCategories stringList
+	filterTags       stringList
+	filterStates     stringList
+	filterSavePaths  stringList
+	minSize          = flag.String(runFlag("min-size"), "", "Only process torrents of at least this size, e.g. 700M")
+	maxSize          = flag.String(runFlag("max-size"), "", "Only process torrents of at most this size, e.g. 50G")
+	addedAfter       = flag.String(runFlag("added-after"), "", "Only process torrents added after this date, e.g. 2020-09-01")
+	addedBefore      = flag.String(runFlag("added-before"), "", "Only process torrents added before this date")
+
+	hashes        stringList
+	hashFile      = flag.String(runFlag("hash-file"), "", "Only process the info hashes in this file, one per line, - for stdin")
+	excludeAdd    stringList
+	excludeRemove stringList
+
+	maxTorrents = flag.Int(runFlag("max"), 0, "Process at most this many torrents per run, 0 for no limit")
+	order       = flag.String(runFlag("order"), "", "Process torrents in this order: "+strings.Join(tool.Orders, ", "))
+	shard       = flag.String(runFlag("shard"), "", "Only process one part of the torrents, e.g. 2/5 for the second of five parts")
+	noCache     = flag.Bool(runFlag("no-cache"), false, "Ask U2 for every key instead of using keys cached by earlier runs")
+	keyFile     = flag.String(runFlag("key-file"), "", "Take the keys from this JSON or CSV file of info hash and key instead of U2")
+	offline     = flag.Bool(runFlag("offline"), false, "Only use keys cached by earlier runs, never ask U2")
+
+	rateLimit      = flag.Float64(runFlag("rate-limit"), 0, fmt.Sprintf("U2 API requests per minute (default %d)", u2.DefaultRequestsPerMinute))
+	maxRetries     = flag.Int(runFlag("max-retries"), 0, fmt.Sprintf("Retries of a failed U2 API request, -1 for none (default %d)", u2.DefaultMaxRetries))
+	batchSize      = flag.Int(runFlag("batch-size"), 0, fmt.Sprintf("Torrents queried from U2 per request, reduced while U2 struggles (default %d)", u2.DefaultBatchSize))
+	queriesPerRun  = flag.Int(runFlag("queries-per-run"), 0, "Torrents queried from U2 per run at most, 0 for no limit")
+	queriesPerHour = flag.Int(runFlag("queries-per-hour"), 0, "Torrents queried from U2 per hour at most on this machine, 0 for no limit")
+	queriesPerDay  = flag.Int(runFlag("queries-per-day"), 0, "Torrents queried from U2 per day at most on this machine, 0 for no limit")
+	cacheTTL       = flag.Duration(runFlag("cache-ttl"), 0, "How long keys fetched from U2 are reused, e.g. 1h, the cache is off by default")
+)
+
+func init() {
+	flag.Var(&filterNames, runFlag("name"), "Only process torrents whose name matches this regex, can be repeated")
+	flag.Var(&filterCategories, runFlag("category"), "Only process torrents in this category (label on Deluge), can be repeated")
+	flag.Var(&filterTags, runFlag("tag"), "Only process torrents with this tag (qBittorrent), can be repeated")
+	flag.Var(&filterStates, runFlag("state"), "Only process torrents in this state: "+strings.Join(u2.States, ", ")+", can be repeated")
+	flag.Var(&filterSavePaths, runFlag("save-path"), "Only process torrents saved under this directory, can be repeated")
+	flag.Var(&hashes, runFlag("hash"), "Only process this info hash, even if already processed, can be repeated")
+	flag.Var(&excludeAdd, runFlag("exclude-add"), "Add an info hash to the list of torrents never touched, can be repeated")
+	flag.Var(&excludeRemove, runFlag("exclude-remove"), "Remove an info hash from the list of torrents never touched, can be repeated")
+}
+
+// runOptions reads the run flags, it exits on invalid values.
+func runOptions() tool.Options {
+	options := tool.Options{
+		AddMissingTracker: *addMissing,
+		OnlyKeyErrors:     *onlyBroken,
+		KeyErrorPattern:   *brokenPattern,
+		NoCache:           *noCache,
+		KeyFile:           *keyFile,
+		Offline:           *offline,
+		Filter: tool.Filter{
+			Names:      filterNames,
+			Categories: filterCategories,
+			Tags:       filterTags,
+			States:     filterStates,
+			SavePaths:  filterSavePaths,
+		},
+	}
+
+	var errs u2.ValidationErrors
+	var err error
+	if *minSize != "" {
+		options.Filter.MinSize, err = tool.ParseSize(*minSize)
+		checkOption(&errs, "min-size", err)
+	}
+	if *maxSize != "" {
+		options.Filter.MaxSize, err = tool.ParseSize(*maxSize)
+		checkOption(&errs, "max-size", err)
+	}
+	if *addedAfter != "" {
+		options.Filter.AddedAfter, err = tool.ParseDate(*addedAfter)
+		checkOption(&errs, "added-after", err)
+	}
+	if *addedBefore != "" {
+		options.Filter.AddedBefore, err = tool.ParseDate(*addedBefore)
+		checkOption(&errs, "added-before", err)
+	}
+	if _, err := u2.KeyErrorMatcher(*brokenPattern); err != nil {
+		checkOption(&errs, "broken-pattern", err)
+	}
+	if len(errs) == 0 {
+		checkOption(&errs, "filter", options.Filter.Validate())
+	}
+	options.Hashes = normalizeHashes(&errs, "hash", hashes)
+	if *hashFile != "" {
+		fileHashes, err := tool.ReadHashFile(*hashFile)
+		checkOption(&errs, "hash-file", err)
+		options.Hashes = append(options.Hashes, fileHashes...)
+	}
+	options.Max = *maxTorrents
+	if options.Max < 0 {
+		checkOption(&errs, "max", fmt.Errorf("maximum %d must not be negative", options.Max))
+	}
+	options.Order = strings.ToLower(*order)
+	checkOption(&errs, "order", tool.ValidateOrder(options.Order))
+	if *shard != "" {
+		options.ShardIndex, options.ShardCount, err = tool.ParseShard(*shard)
+		checkOption(&errs, "shard", err)
+	}
+	if options.KeyFile != "" && (options.Offline || options.NoCache) {
+		checkOption(&errs, "key-file", fmt.Errorf("can't be combined with -offline or -no-cache"))
+	}
+	if options.Offline && options.NoCache {
+		checkOption(&errs, "offline", fmt.Errorf("can't be combined with -no-cache"))
+	}
+	excludeAdd = normalizeHashes(&errs, "exclude-add", excludeAdd)
+	excludeRemove = normalizeHashes(&errs, "exclude-remove", excludeRemove)
+
+	exitOnErrors(errs)
+	return options
+}
+
+// applyRunConfig sets the U2 API settings given as flags in config, which is
+// saved with them. It exits when they are invalid or the run flags don't
+// work with config.
+func applyRunConfig(config *u2.Config) {
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "rate-limit":
+			config.RateLimit.RequestsPerMinute = *rateLimit
+		case "max-retries":
+			config.Retry.MaxRetries = *maxRetries
+		case "batch-size":
+			config.Batch.Size = *batchSize
+		case "queries-per-run":
+			config.Budget.PerRun = *queriesPerRun
+		case "queries-per-hour":
+			config.Budget.PerHour = *queriesPerHour
+		case "queries-per-day":
+			config.Budget.PerDay = *queriesPerDay
+		case "cache-ttl":
+			config.Cache.TTL = u2.Duration(*cacheTTL)
+		}
+	})
+	errs := config.Validate()
+	if *migrateTo != "" {
+		errs = errs.Without("ApiKey")
+	}
+	if *offline && config.Cache.TTL <= 0 {
+		checkOption(&errs, "offline", fmt.Errorf("needs the key cache, set -cache-ttl"))
+	}
+	exitOnErrors(errs)
+}
+
+// exitOnErrors prints errs with the usage and exits with 2, the exit code of
+// invalid flags.
+func exitOnErrors(errs u2.ValidationErrors) {
+	if len(errs) > 0 {
+		tool.TurnOnSilentMode()
+		tool.PrintValidationErrors(errs)
+		flag.Usage()
+		tool.KeepWindow(2)
+	}
+}
+
+// checkOption records err for the flag field, a nil err is ignored.
+func checkOption(errs *u2.ValidationErrors, field string, err error) {
+	if err != nil {
+		*errs = append(*errs, u2.FieldError{Field: field, Message: err.Error()})
+	}
+}
+
+func normalizeHashes(errs *u2.ValidationErrors, field string, values []string) []string {
+	var hashes []string
+	for _, value := range values {
+		hash, err := tool.NormalizeHash(value)
+		checkOption(errs, field, err)
+		if err == nil {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+func connectionFlagCount() int {
+	count := 0
+	flag.Visit(func(f *flag.Flag) {
+		if !runFlags[f.Name] {
+			count++
+		}
+	})
+	return count
+}
@@ -0,0 +1,80 @@
+package tool
+
+import (
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+)
+
+// growAfter is the number of clean batches before the batch size grows again.
+const growAfter = 3
+
+// batchSizer adapts the batch size: it halves on failures and doubles after
+// growAfter clean batches, staying between the configured limits.
+type batchSizer struct {
+	current   int
+	max       int
+	min       int
+	successes int
+}
+
+func newBatchSizer(config u2.BatchConfig) *batchSizer {
+	size, minSize := config.Sizes()
+	return &batchSizer{current: size, max: size, min: minSize}
+}
+
+// size returns the size of the next batch, within serverMax when U2 gave one.
+func (b *batchSizer) size(serverMax int) int {
+	if serverMax > 0 && b.current > serverMax {
+		fmt.Printf("U2 accepts at most %d torrent(s) per batch.\n", serverMax)
+		b.limit(serverMax)
+	}
+	return b.current
+}
+
+// limit keeps all later batches at most n large, even below the minimum. It
+// returns false when the batch size can't get smaller.
+func (b *batchSizer) limit(n int) bool {
+	if n < 1 || b.current <= n {
+		return false
+	}
+	b.successes = 0
+	b.current = n
+	if b.max > n {
+		b.max = n
+	}
+	if b.min > n {
+		b.min = n
+	}
+	return true
+}
+
+// shrink halves the size of a failed batch of n torrents down to the minimum.
+// It returns false when the size is already the minimum.
+func (b *batchSizer) shrink(n int, reason string) bool {
+	b.successes = 0
+	if n < b.current {
+		b.current = n
+	}
+	if b.current <= b.min {
+		return false
+	}
+	b.current /= 2
+	if b.current < b.min {
+		b.current = b.min
+	}
+	fmt.Printf("Batch size reduced to %d because of %s.\n", b.current, reason)
+	return true
+}
+
+func (b *batchSizer) success() {
+	b.successes++
+	if b.successes < growAfter || b.current >= b.max {
+		return
+	}
+	b.successes = 0
+	b.current *= 2
+	if b.current > b.max {
+		b.current = b.max
+	}
+	fmt.Printf("Batch size increased to %d.\n", b.current)
+}
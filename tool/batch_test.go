@@ -0,0 +1,93 @@
+package tool
+
+import (
+	"github.com/i0range/U2KeyResetTool/u2"
+	"testing"
+)
+
+func TestBatchSizerShrink(t *testing.T) {
+	tests := []struct {
+		name   string
+		config u2.BatchConfig
+		failed int
+		sizes  []int
+	}{
+		{"halves to the minimum", u2.BatchConfig{Size: 100, MinSize: 10}, 100, []int{50, 25, 12, 10}},
+		{"floors at the minimum", u2.BatchConfig{Size: 100, MinSize: 30}, 100, []int{50, 30}},
+		{"from a smaller batch", u2.BatchConfig{Size: 100, MinSize: 5}, 20, []int{10, 5}},
+		{"minimum of one", u2.BatchConfig{Size: 4, MinSize: 1}, 4, []int{2, 1}},
+		{"already at the minimum", u2.BatchConfig{Size: 10, MinSize: 10}, 10, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sizer := newBatchSizer(test.config)
+			n := test.failed
+			for _, want := range test.sizes {
+				if !sizer.shrink(n, "a test") {
+					t.Fatalf("shrink(%d) = false, want size %d", n, want)
+				}
+				if n = sizer.size(0); n != want {
+					t.Fatalf("size after shrink = %d, want %d", n, want)
+				}
+			}
+			if sizer.shrink(n, "a test") {
+				t.Errorf("shrink(%d) at the minimum = true, size %d", n, sizer.size(0))
+			}
+		})
+	}
+}
+
+func TestBatchSizerGrow(t *testing.T) {
+	sizer := newBatchSizer(u2.BatchConfig{Size: 100, MinSize: 10})
+	sizer.shrink(100, "a test")
+	sizer.shrink(50, "a test")
+	sizes := []int{25, 25, 50, 50, 50, 100, 100, 100, 100}
+	for i, want := range sizes {
+		sizer.success()
+		if size := sizer.size(0); size != want {
+			t.Fatalf("size after %d clean batches = %d, want %d", i+1, size, want)
+		}
+	}
+
+	// A failure starts the count of clean batches again.
+	sizer.shrink(100, "a test")
+	sizer.success()
+	sizer.success()
+	sizer.shrink(50, "a test")
+	for i := 0; i < growAfter-1; i++ {
+		sizer.success()
+	}
+	if size := sizer.size(0); size != 25 {
+		t.Errorf("size after %d clean batches = %d, want 25", growAfter-1, size)
+	}
+}
+
+func TestBatchSizerLimit(t *testing.T) {
+	sizer := newBatchSizer(u2.BatchConfig{Size: 100, MinSize: 10})
+	if !sizer.limit(40) {
+		t.Fatal("limit(40) = false")
+	}
+	if sizer.limit(40) || sizer.limit(60) || sizer.limit(0) {
+		t.Error("limit without getting smaller = true")
+	}
+	for i := 0; i < 3*growAfter; i++ {
+		sizer.success()
+	}
+	if size := sizer.size(0); size != 40 {
+		t.Errorf("size after clean batches = %d, want the limit of 40", size)
+	}
+
+	// A limit below the minimum lowers the minimum as well.
+	if size := sizer.size(4); size != 4 {
+		t.Errorf("size(4) = %d, want the server maximum of 4", size)
+	}
+	if sizer.shrink(4, "a test") {
+		t.Errorf("shrink below the server maximum = true, size %d", sizer.size(0))
+	}
+	for i := 0; i < 3*growAfter; i++ {
+		sizer.success()
+	}
+	if size := sizer.size(0); size != 4 {
+		t.Errorf("size after clean batches = %d, want the server maximum of 4", size)
+	}
+}
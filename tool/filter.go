@@ -0,0 +1,188 @@
+package tool
+
+import (
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter limits a run to the torrents matching every condition that is set.
+// A condition with several values matches when any of them does.
+type Filter struct {
+	Names       []string
+	Categories  []string
+	Tags        []string
+	States      []string
+	SavePaths   []string
+	MinSize     int64
+	MaxSize     int64
+	AddedAfter  time.Time
+	AddedBefore time.Time
+}
+
+func (f *Filter) IsZero() bool {
+	return len(f.Names) == 0 && len(f.Categories) == 0 && len(f.Tags) == 0 && len(f.States) == 0 &&
+		len(f.SavePaths) == 0 && f.MinSize == 0 && f.MaxSize == 0 && f.AddedAfter.IsZero() && f.AddedBefore.IsZero()
+}
+
+func (f *Filter) Validate() error {
+	for _, state := range f.States {
+		if !containsFold(u2.States, state) {
+			return fmt.Errorf("unknown state %q, use one of %s", state, strings.Join(u2.States, ", "))
+		}
+	}
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return fmt.Errorf("minimum size is larger than maximum size")
+	}
+	_, err := compileNames(f.Names)
+	return err
+}
+
+func compileNames(names []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, name := range names {
+		re, err := regexp.Compile("(?i)" + name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %v", name, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// filterTorrents returns the torrents matching f.
+func (f *Filter) filterTorrents(torrents []u2.Torrent) ([]u2.Torrent, error) {
+	if f.IsZero() {
+		return torrents, nil
+	}
+	names, err := compileNames(f.Names)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []u2.Torrent
+	for _, torrent := range torrents {
+		if f.match(&torrent, names) {
+			matched = append(matched, torrent)
+		}
+	}
+	return matched, nil
+}
+
+func (f *Filter) match(torrent *u2.Torrent, names []*regexp.Regexp) bool {
+	if len(names) > 0 {
+		found := false
+		for _, re := range names {
+			if re.MatchString(torrent.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Categories) > 0 && !containsFold(f.Categories, torrent.Category) {
+		return false
+	}
+	if len(f.Tags) > 0 {
+		found := false
+		for _, tag := range torrent.Tags {
+			if containsFold(f.Tags, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.States) > 0 && !containsFold(f.States, torrent.State) {
+		return false
+	}
+	if len(f.SavePaths) > 0 {
+		found := false
+		for _, savePath := range f.SavePaths {
+			if isUnderPath(torrent.SavePath, savePath) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.MinSize > 0 && torrent.Size < f.MinSize {
+		return false
+	}
+	if f.MaxSize > 0 && torrent.Size > f.MaxSize {
+		return false
+	}
+	if !f.AddedAfter.IsZero() && !torrent.AddedTime.After(f.AddedAfter) {
+		return false
+	}
+	if !f.AddedBefore.IsZero() && (torrent.AddedTime.IsZero() || !torrent.AddedTime.Before(f.AddedBefore)) {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnderPath compares whole path elements, so /mnt/u2 does not match /mnt/u23.
+func isUnderPath(path string, dir string) bool {
+	path = strings.TrimRight(strings.ReplaceAll(path, "\\", "/"), "/")
+	dir = strings.TrimRight(strings.ReplaceAll(dir, "\\", "/"), "/")
+	if path == "" {
+		return false
+	}
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+var sizeUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tib": 1 << 40,
+}
+
+// ParseSize reads sizes like 700M or 1.5GiB, units are powers of 1024.
+func ParseSize(raw string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(raw))
+	split := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if split < 0 {
+		split = len(value)
+	}
+	number, err := strconv.ParseFloat(value[:split], 64)
+	unit, ok := sizeUnits[strings.TrimSpace(value[split:])]
+	if err != nil || !ok || number < 0 {
+		return 0, fmt.Errorf("invalid size %q, e.g. 700M or 1.5G", raw)
+	}
+	return int64(number * float64(unit)), nil
+}
+
+// ParseDate reads a local date like 2020-09-01 or an RFC 3339 time.
+func ParseDate(value string) (time.Time, error) {
+	if date, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, e.g. 2020-09-01", value)
+	}
+	return date, nil
+}
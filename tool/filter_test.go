@@ -0,0 +1,63 @@
+package tool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		raw  string
+		size int64
+	}{
+		{"1024", 1024},
+		{"0", 0},
+		{"12b", 12},
+		{"700M", 700 << 20},
+		{"700mb", 700 << 20},
+		{"1.5GiB", 3 << 29},
+		{" 2 kb ", 2 << 10},
+		{"1T", 1 << 40},
+		{".5k", 512},
+	}
+	for _, test := range tests {
+		size, err := ParseSize(test.raw)
+		if err != nil || size != test.size {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", test.raw, size, err, test.size)
+		}
+	}
+}
+
+func TestParseSizeInvalid(t *testing.T) {
+	for _, raw := range []string{"", "M", "-1", "-1G", "10X", "1e3", "1.5.5G", "1 G B", "1PB"} {
+		if size, err := ParseSize(raw); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", raw, size)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value string
+		date  time.Time
+	}{
+		{"2020-09-01", time.Date(2020, 9, 1, 0, 0, 0, 0, time.Local)},
+		{"2020-02-29", time.Date(2020, 2, 29, 0, 0, 0, 0, time.Local)},
+		{"2020-09-01T08:30:00Z", time.Date(2020, 9, 1, 8, 30, 0, 0, time.UTC)},
+		{"2020-09-01T08:30:00+08:00", time.Date(2020, 9, 1, 0, 30, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		date, err := ParseDate(test.value)
+		if err != nil || !date.Equal(test.date) {
+			t.Errorf("ParseDate(%q) = %s, %v, want %s", test.value, date, err, test.date)
+		}
+	}
+}
+
+func TestParseDateInvalid(t *testing.T) {
+	for _, value := range []string{"", "2020-9-1", "2020/09/01", "2021-02-29", "2020-09-01 08:30", "2020-09-01T08:30:00", "yesterday"} {
+		if date, err := ParseDate(value); err == nil {
+			t.Errorf("ParseDate(%q) = %s, want an error", value, date)
+		}
+	}
+}
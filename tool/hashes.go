@@ -0,0 +1,101 @@
+package tool
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const excludeFileName = "exclude.txt"
+
+var hashPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// NormalizeHash lowercases an info hash and checks its shape.
+func NormalizeHash(hash string) (string, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if !hashPattern.MatchString(hash) {
+		return "", fmt.Errorf("invalid info hash %q", hash)
+	}
+	return hash, nil
+}
+
+// ReadHashList reads one info hash per line, blank lines and lines starting
+// with # are skipped.
+func ReadHashList(reader io.Reader) ([]string, error) {
+	var hashes []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, err := NormalizeHash(line)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, scanner.Err()
+}
+
+// ReadHashFile reads a hash list from path, or from stdin when path is "-".
+func ReadHashFile(path string) ([]string, error) {
+	if path == "-" {
+		return ReadHashList(os.Stdin)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadHashList(file)
+}
+
+func hashSet(hashes []string) map[string]bool {
+	set := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		set[strings.ToLower(hash)] = true
+	}
+	return set
+}
+
+// readExcludes returns the hashes that must never be touched.
+func readExcludes() map[string]bool {
+	hashes, err := ReadHashFile(excludeFileName)
+	if os.IsNotExist(err) {
+		return make(map[string]bool)
+	}
+	if err != nil {
+		fmt.Printf("Error while reading %s!\n", excludeFileName)
+		panic(err)
+	}
+	return hashSet(hashes)
+}
+
+// UpdateExcludes adds and removes hashes from the exclude list.
+func UpdateExcludes(add []string, remove []string) {
+	excludes := readExcludes()
+	for _, hash := range add {
+		excludes[hash] = true
+	}
+	for _, hash := range remove {
+		delete(excludes, hash)
+	}
+
+	hashes := make([]string, 0, len(excludes))
+	for hash := range excludes {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	content := "# Torrents never touched by U2KeyResetTool, one info hash per line.\n" + strings.Join(hashes, "\n") + "\n"
+	if err := ioutil.WriteFile(excludeFileName, []byte(content), os.FileMode(0644)); err != nil {
+		fmt.Println("Write exclude list failed!")
+		panic(err)
+	}
+	fmt.Printf("Exclude list has %d torrent(s).\n", len(hashes))
+}
@@ -0,0 +1,81 @@
+package tool
+
+import (
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"sort"
+	"strings"
+)
+
+// ExportKeys writes the keys in the announce URLs of all U2 torrents to path.
+func ExportKeys(path string) {
+	defer client.Close()
+	var keys []u2.ExportedKey
+	skipped := 0
+	for _, torrent := range *readTorrents() {
+		key := u2.ParseSecure(torrent.Tracker)
+		if key == "" {
+			fmt.Printf("Skip torrent %s %s, its announce URL has no key.\n", torrent.Hash, torrent.Name)
+			skipped++
+			continue
+		}
+		keys = append(keys, u2.ExportedKey{Hash: strings.ToLower(torrent.Hash), Name: torrent.Name, Key: key})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Hash < keys[j].Hash
+	})
+
+	if err := u2.WriteKeyFile(path, keys); err != nil {
+		fmt.Printf("Error while writing %s!\n", path)
+		panic(err)
+	}
+	fmt.Printf("Exported %d key(s) to %s, skipped %d.\n", len(keys), path, skipped)
+}
+
+// ImportKeys writes the keys of a key file to the matching U2 torrents. With
+// addMissing the U2 tracker is also added to listed torrents without it.
+func ImportKeys(path string, addMissing bool) {
+	defer client.Close()
+	keys, err := u2.ReadKeyFile(path)
+	if err != nil {
+		fmt.Printf("Error while reading %s!\n", path)
+		panic(err)
+	}
+	torrents := *readTorrents()
+	if addMissing {
+		for _, meta := range *client.GetUntrackedTorrents(trackerMatcher()) {
+			if _, ok := keys[strings.ToLower(meta.Torrent.Hash)]; ok {
+				torrents = append(torrents, meta.Torrent)
+			}
+		}
+	}
+	records := readRecords()
+	excludes := readExcludes()
+
+	imported, unchanged, skipped := 0, 0, 0
+	for _, torrent := range torrents {
+		hash := strings.ToLower(torrent.Hash)
+		key, ok := keys[hash]
+		if !ok {
+			continue
+		}
+		if excludes[hash] {
+			fmt.Printf("Skip excluded torrent %s %s\n", torrent.Hash, torrent.Name)
+			skipped++
+			continue
+		}
+		if torrent.Tracker != "" && u2.ParseSecure(torrent.Tracker) == key {
+			unchanged++
+			continue
+		}
+		if updateTorrent(torrent, key) {
+			records[torrent.Hash] = recordDone
+			imported++
+		} else {
+			skipped++
+		}
+	}
+	saveRecords(records)
+
+	fmt.Printf("Imported %d key(s) from %s, %d already set, skipped %d, %d not in the client.\n", imported, path, unchanged, skipped, len(keys)-imported-unchanged-skipped)
+}
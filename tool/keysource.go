@@ -0,0 +1,45 @@
+package tool
+
+import (
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+)
+
+var keySource u2.KeySource
+
+// newKeySource picks where the keys of this run come from: a key file, the
+// key cache when offline, or U2.
+func newKeySource() u2.KeySource {
+	if options.KeyFile != "" {
+		source, err := u2.NewStaticKeySource(options.KeyFile)
+		if err != nil {
+			fmt.Printf("Error while reading key file %s!\n", options.KeyFile)
+			panic(err)
+		}
+		return source
+	}
+	if options.Offline {
+		return u2.NewCacheKeySource(keyCache)
+	}
+	return client
+}
+
+// isLive tells whether keys are queried from U2, the only source with a rate
+// limit, a query budget and keys worth caching.
+func isLive() bool {
+	return keySource == u2.KeySource(client)
+}
+
+func maxBatchSize() int {
+	if !isLive() {
+		return 0
+	}
+	return client.MaxBatchSize()
+}
+
+func remainingQueries() int {
+	if !isLive() {
+		return -1
+	}
+	return client.RemainingQueries()
+}
@@ -0,0 +1,42 @@
+package tool
+
+import (
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"strings"
+)
+
+// MigrateTrackers moves the announce URLs of all U2 torrents to host without
+// asking U2 for new keys.
+func MigrateTrackers(host string) {
+	defer client.Close()
+	torrents := readTorrents()
+	records := readRecords()
+	excludes := readExcludes()
+
+	migrated, skipped := 0, 0
+	for _, torrent := range *torrents {
+		if excludes[strings.ToLower(torrent.Hash)] {
+			fmt.Printf("Skip excluded torrent %s %s\n", torrent.Hash, torrent.Name)
+			continue
+		}
+		announce, err := u2.RewriteAnnounceHost(torrent.Tracker, host)
+		if err != nil {
+			fmt.Printf("Skip torrent %s: %v\n", torrent.Hash, err)
+			skipped++
+			continue
+		}
+		if strings.EqualFold(announce, torrent.Tracker) {
+			continue
+		}
+		if client.EditTorrentTracker(&torrent, announce) {
+			records[torrent.Hash] = recordDone
+			migrated++
+		} else {
+			skipped++
+		}
+	}
+	saveRecords(records)
+
+	fmt.Printf("Migrated %d torrent(s) to %s, skipped %d.\n", migrated, host, skipped)
+}
@@ -0,0 +1,42 @@
+package tool
+
+// Options choose which torrents a run processes. Unlike u2.Config they are
+// given per run and not saved.
+type Options struct {
+	// AddMissingTracker also processes torrents recognised as U2 by their
+	// metadata and adds the U2 tracker to them.
+	AddMissingTracker bool
+
+	// OnlyKeyErrors limits the run to torrents whose last announce failed with
+	// a message matching KeyErrorPattern, u2.DefaultKeyErrorPattern when empty.
+	OnlyKeyErrors   bool
+	KeyErrorPattern string
+
+	Filter Filter
+
+	// Hashes limits the run to these info hashes, processed even when they
+	// are in the records.
+	Hashes []string
+
+	// Max caps the torrents processed in one run after taking the shard
+	// ShardIndex of ShardCount and sorting them by Order.
+	Max        int
+	Order      string
+	ShardIndex int
+	ShardCount int
+
+	// NoCache asks U2 for every key instead of using keys cached from earlier
+	// runs. Fetched keys are still cached.
+	NoCache bool
+
+	// KeyFile takes the keys from this file instead of U2, Offline from the
+	// key cache only.
+	KeyFile string
+	Offline bool
+}
+
+var options Options
+
+func SetOptions(runOptions Options) {
+	options = runOptions
+}
@@ -0,0 +1,116 @@
+package tool
+
+import (
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	OrderActive = "active"
+	OrderNewest = "newest"
+	OrderUpload = "upload"
+	OrderHash   = "hash"
+)
+
+var Orders = []string{OrderActive, OrderNewest, OrderUpload, OrderHash}
+
+func ValidateOrder(order string) error {
+	if order != "" && !containsFold(Orders, order) {
+		return fmt.Errorf("unknown order %q, use one of %s", order, strings.Join(Orders, ", "))
+	}
+	return nil
+}
+
+// sortTorrents orders torrents in place, ties are broken by hash so every run
+// picks the same torrents. An empty order keeps the order of the client.
+func sortTorrents(torrents []u2.Torrent, order string) {
+	var less func(a, b *u2.Torrent) bool
+	switch strings.ToLower(order) {
+	case OrderActive:
+		less = func(a, b *u2.Torrent) bool {
+			if (a.UploadRate > 0) != (b.UploadRate > 0) {
+				return a.UploadRate > 0
+			}
+			if (a.State == u2.StateSeeding) != (b.State == u2.StateSeeding) {
+				return a.State == u2.StateSeeding
+			}
+			return a.UploadRate > b.UploadRate
+		}
+	case OrderNewest:
+		less = func(a, b *u2.Torrent) bool {
+			return a.AddedTime.After(b.AddedTime)
+		}
+	case OrderUpload:
+		less = func(a, b *u2.Torrent) bool {
+			return a.Uploaded > b.Uploaded
+		}
+	case OrderHash:
+		less = func(a, b *u2.Torrent) bool {
+			return false
+		}
+	default:
+		return
+	}
+	sort.SliceStable(torrents, func(i, j int) bool {
+		if less(&torrents[i], &torrents[j]) {
+			return true
+		}
+		if less(&torrents[j], &torrents[i]) {
+			return false
+		}
+		return strings.ToLower(torrents[i].Hash) < strings.ToLower(torrents[j].Hash)
+	})
+}
+
+// ParseShard reads "index/count" such as 2/5, index starts at 1.
+func ParseShard(value string) (int, int, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) == 2 {
+		index, indexErr := strconv.Atoi(strings.TrimSpace(parts[0]))
+		count, countErr := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if indexErr == nil && countErr == nil && count > 0 && index >= 1 && index <= count {
+			return index, count, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid shard %q, e.g. 2/5 for the second of five parts", value)
+}
+
+// inShard spreads torrents over count shards by their info hash, so a torrent
+// stays in the same shard no matter what else is in the client.
+func inShard(hash string, index int, count int) bool {
+	if count <= 1 {
+		return true
+	}
+	prefix := hash
+	if len(prefix) > 8 {
+		prefix = prefix[:8]
+	}
+	value, err := strconv.ParseUint(prefix, 16, 64)
+	if err != nil {
+		return index == 1
+	}
+	return int(value%uint64(count)) == index-1
+}
+
+// limitTorrents applies the shard, order and maximum of the run options.
+func limitTorrents(torrents []u2.Torrent) []u2.Torrent {
+	if options.ShardCount > 1 {
+		var shard []u2.Torrent
+		for _, torrent := range torrents {
+			if inShard(torrent.Hash, options.ShardIndex, options.ShardCount) {
+				shard = append(shard, torrent)
+			}
+		}
+		fmt.Printf("Shard %d/%d has %d of %d torrent(s).\n", options.ShardIndex, options.ShardCount, len(shard), len(torrents))
+		torrents = shard
+	}
+	sortTorrents(torrents, options.Order)
+	if options.Max > 0 && len(torrents) > options.Max {
+		fmt.Printf("Only process %d of %d torrent(s) this run.\n", options.Max, len(torrents))
+		torrents = torrents[:options.Max]
+	}
+	return torrents
+}
@@ -0,0 +1,149 @@
+package tool
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testHash(i int) string {
+	sum := sha1.Sum([]byte(strconv.Itoa(i)))
+	return hex.EncodeToString(sum[:])
+}
+
+func hashesOf(torrents []u2.Torrent) []string {
+	hashes := make([]string, 0, len(torrents))
+	for _, torrent := range torrents {
+		hashes = append(hashes, torrent.Hash)
+	}
+	return hashes
+}
+
+func TestParseShard(t *testing.T) {
+	tests := []struct {
+		value string
+		index int
+		count int
+	}{
+		{"1/1", 1, 1},
+		{"2/5", 2, 5},
+		{"5/5", 5, 5},
+		{" 3 / 4 ", 3, 4},
+	}
+	for _, test := range tests {
+		index, count, err := ParseShard(test.value)
+		if err != nil || index != test.index || count != test.count {
+			t.Errorf("ParseShard(%q) = %d, %d, %v, want %d/%d", test.value, index, count, err, test.index, test.count)
+		}
+	}
+	for _, value := range []string{"", "2", "0/5", "6/5", "1/0", "-1/5", "1/2/3", "a/5"} {
+		if index, count, err := ParseShard(value); err == nil {
+			t.Errorf("ParseShard(%q) = %d/%d, want an error", value, index, count)
+		}
+	}
+}
+
+func TestInShard(t *testing.T) {
+	hashes := []string{"", "not a hash", "00000000", "ffffffffffffffffffffffffffffffffffffffff"}
+	for i := 0; i < 1000; i++ {
+		hashes = append(hashes, testHash(i))
+	}
+	for count := 1; count <= 7; count++ {
+		sizes := make([]int, count)
+		for _, hash := range hashes {
+			shards := 0
+			for index := 1; index <= count; index++ {
+				if inShard(hash, index, count) {
+					shards++
+					sizes[index-1]++
+				}
+				if inShard(strings.ToUpper(hash), index, count) != inShard(hash, index, count) {
+					t.Errorf("shard %d/%d of %q depends on the case", index, count, hash)
+				}
+			}
+			if shards != 1 {
+				t.Errorf("%q is in %d of %d shards, want 1", hash, shards, count)
+			}
+		}
+		// Every shard gets a fair part of the random hashes.
+		for index, size := range sizes {
+			if size < 1000/count/2 {
+				t.Errorf("shard %d/%d has %d of %d hashes", index+1, count, size, len(hashes))
+			}
+		}
+	}
+}
+
+func TestSortTorrents(t *testing.T) {
+	now := time.Now()
+	torrents := []u2.Torrent{
+		{Hash: "cc", State: u2.StateSeeding, AddedTime: now.Add(-time.Hour), Uploaded: 10},
+		{Hash: "aa", State: u2.StatePaused, AddedTime: now, Uploaded: 30},
+		{Hash: "dd", State: u2.StateSeeding, AddedTime: now.Add(-2 * time.Hour), Uploaded: 30, UploadRate: 5},
+		{Hash: "BB", State: u2.StateDownloading, AddedTime: now, Uploaded: 0, UploadRate: 50},
+	}
+	tests := []struct {
+		order  string
+		hashes string
+	}{
+		{"", "cc aa dd BB"},
+		{OrderActive, "dd BB cc aa"},
+		{OrderNewest, "aa BB cc dd"},
+		{OrderUpload, "aa dd cc BB"},
+		{"HASH", "aa BB cc dd"},
+	}
+	for _, test := range tests {
+		sorted := append([]u2.Torrent(nil), torrents...)
+		sortTorrents(sorted, test.order)
+		if hashes := strings.Join(hashesOf(sorted), " "); hashes != test.hashes {
+			t.Errorf("order %q = %s, want %s", test.order, hashes, test.hashes)
+		}
+	}
+}
+
+func TestLimitTorrents(t *testing.T) {
+	saved := options
+	t.Cleanup(func() { options = saved })
+
+	var torrents []u2.Torrent
+	for i := 0; i < 40; i++ {
+		torrents = append(torrents, u2.Torrent{Hash: testHash(i), Uploaded: int64(i)})
+	}
+	tests := []struct {
+		name  string
+		index int
+		count int
+		max   int
+	}{
+		{"all", 0, 0, 0},
+		{"max", 0, 0, 5},
+		{"shard", 2, 3, 0},
+		{"shard and max", 2, 3, 3},
+		{"max above shard", 1, 3, 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options = Options{ShardIndex: test.index, ShardCount: test.count, Order: OrderUpload, Max: test.max}
+
+			// The maximum is taken from the most uploaded torrents of the
+			// shard, not of the whole client.
+			var want []string
+			for i := len(torrents) - 1; i >= 0; i-- {
+				if test.count == 0 || inShard(torrents[i].Hash, test.index, test.count) {
+					want = append(want, torrents[i].Hash)
+				}
+			}
+			if test.max > 0 && len(want) > test.max {
+				want = want[:test.max]
+			}
+			got := hashesOf(limitTorrents(append([]u2.Torrent(nil), torrents...)))
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("limitTorrents = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package tool
+
+import (
+	"bufio"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"strings"
+)
+
+// ReadPassword reads one line with terminal echo turned off when stdin is a
+// terminal, otherwise from reader.
+func ReadPassword(reader *bufio.Reader) string {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		pass, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err == nil {
+			return string(pass)
+		}
+	}
+	pass, _ := reader.ReadString('\n')
+	return strings.TrimRight(pass, "\r\n")
+}
@@ -2,46 +2,102 @@ package tool
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/i0range/U2KeyResetTool/u2"
 	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 )
 
 const (
 	processRecordFileName = "record.json"
-	toTracker             = "https://daydream.dmhy.best/announce?secure="
-	batchSize             = 100
+
+	maxRateLimitRetries  = 3
+	maxBatchFailures     = 3
+	defaultRateLimitWait = 60 * time.Second
+)
+
+// Values in the records file.
+const (
+	recordDone    = 1
+	recordDeleted = 2
 )
 
 var (
-	silentMode = false
-	client     *u2.Client
+	silentMode    = false
+	client        *u2.Client
+	currentConfig *u2.Config
+	keyCache      *u2.KeyCache
 )
 
 func ProcessTorrent() {
+	defer client.Close()
 	torrents := readTorrents()
+	if options.AddMissingTracker {
+		untracked := readUntrackedTorrents()
+		merged := append(*torrents, *untracked...)
+		torrents = &merged
+	}
 	mutateTorrentKey(torrents)
 }
 
 func InitClient(config *u2.Config) {
-	config.Validate()
+	config.Normalize()
+	if errs := config.Validate(); len(errs) > 0 {
+		PrintValidationErrors(errs)
+		panic(errs)
+	}
+	initClient(config)
+}
+
+// InitLocalClient is InitClient for work that never asks U2, so the API key
+// may be missing.
+func InitLocalClient(config *u2.Config) {
+	config.Normalize()
+	if errs := config.Validate().Without("ApiKey"); len(errs) > 0 {
+		PrintValidationErrors(errs)
+		panic(errs)
+	}
+	initClient(config)
+}
+
+func initClient(config *u2.Config) {
+	currentConfig = config
 	makeU2Client(config)
 
 	defer func() {
 		if err := recover(); err != nil {
-			if config.Secure {
-				fmt.Printf("Please check your %s server https://%s:%d\n", config.Target, config.Host, config.Port)
-			} else {
-				fmt.Printf("Please check your %s server http://%s:%d\n", config.Target, config.Host, config.Port)
-			}
+			fmt.Printf("Please check your %s server %s\n", config.Target, config.ConnectionUrl())
 			panic(err)
 		}
 	}()
 	checkVersion()
 }
 
+func TestConnection(config *u2.Config) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	testClient, err := u2.NewClient(config)
+	if err != nil {
+		return err
+	}
+	defer testClient.Close()
+	ok, err := testClient.Check()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("unsupported %s server", config.Target)
+	}
+	return nil
+}
+
 func TurnOnSilentMode() {
 	silentMode = true
 }
@@ -68,75 +124,271 @@ func checkVersion() {
 }
 
 func readTorrents() *[]u2.Torrent {
-	return client.GetTorrentList("dmhy")
+	return client.GetTorrentList(trackerMatcher())
+}
+
+// readUntrackedTorrents finds U2 torrents without a U2 tracker by their
+// metadata or the configured hash list.
+func readUntrackedTorrents() *[]u2.Torrent {
+	metadataMatcher, err := u2.NewMetadataMatcher(currentConfig.Metadata)
+	if err != nil {
+		fmt.Println("Invalid metadata rules!")
+		panic(err)
+	}
+
+	var torrents []u2.Torrent
+	for _, meta := range *client.GetUntrackedTorrents(trackerMatcher()) {
+		if reason, ok := metadataMatcher.Match(&meta); ok {
+			fmt.Printf("Found U2 torrent without U2 tracker by %s: %s %s\n", reason, meta.Torrent.Hash, meta.Torrent.Name)
+			torrents = append(torrents, meta.Torrent)
+		}
+	}
+	fmt.Printf("Found %d torrent(s) without U2 tracker!\n", len(torrents))
+	return &torrents
+}
+
+func trackerMatcher() *u2.TrackerMatcher {
+	matcher, err := u2.NewTrackerMatcher(currentConfig.TrackerRules)
+	if err != nil {
+		fmt.Println("Invalid tracker rules!")
+		panic(err)
+	}
+	return matcher
 }
 
 func mutateTorrentKey(torrents *[]u2.Torrent) {
 	records := readRecords()
+	filtered, err := options.Filter.filterTorrents(*torrents)
+	if err != nil {
+		fmt.Println("Invalid filter!")
+		panic(err)
+	}
+	if skipped := len(*torrents) - len(filtered); skipped > 0 {
+		fmt.Printf("Skip %d torrent(s) not matching the filter.\n", skipped)
+	}
+	keyError, err := u2.KeyErrorMatcher(options.KeyErrorPattern)
+	if err != nil {
+		fmt.Println("Invalid key error pattern!")
+		panic(err)
+	}
+	excludes := readExcludes()
+	listed := hashSet(options.Hashes)
+	found := make(map[string]bool)
 	var needProcessTorrents []u2.Torrent
-	for _, torrent := range *torrents {
-		if _, ok := records[torrent.Hash]; ok {
+	for _, torrent := range filtered {
+		hash := strings.ToLower(torrent.Hash)
+		if len(listed) > 0 {
+			if !listed[hash] {
+				continue
+			}
+			found[hash] = true
+		}
+		if excludes[hash] {
+			fmt.Printf("Skip excluded torrent %s %s\n", torrent.Hash, torrent.Name)
+			continue
+		}
+		if records[torrent.Hash] == recordDeleted && !listed[hash] {
+			continue
+		}
+		// A broken key or a lost tracker needs a fix even when recorded.
+		if options.OnlyKeyErrors {
+			if torrent.Tracker != "" && !torrent.HasKeyError(keyError) {
+				continue
+			}
+		} else if _, ok := records[torrent.Hash]; ok && torrent.Tracker != "" && !listed[hash] {
 			continue
 		}
 		needProcessTorrents = append(needProcessTorrents, torrent)
 	}
+	if missing := len(listed) - len(found); missing > 0 {
+		fmt.Printf("%d listed torrent(s) not found as U2 torrent in the client.\n", missing)
+	}
+	needProcessTorrents = limitTorrents(needProcessTorrents)
 
 	fmt.Printf("Found %d torrent(s) to process!\n", len(needProcessTorrents))
 
-	for {
-		count := 0
-		var requestData []u2.U2Request
-		torrentMap := make(map[int]u2.Torrent)
-		for _, torrent := range needProcessTorrents {
-			count += 1
-			requestData = append(requestData, u2.U2Request{
-				JsonRpc: "2.0",
-				Method:  "query",
-				Params:  []string{torrent.Hash},
-				Id:      count,
-			})
-			torrentMap[count] = torrent
-
-			if count == batchSize {
-				doMutate(records, &requestData, torrentMap)
-				count = 0
-				requestData = []u2.U2Request{}
-				torrentMap = make(map[int]u2.Torrent)
-				fmt.Println("Wait 5 seconds for next batch.")
-				time.Sleep(5 * time.Second)
-			}
+	keyCache = u2.NewKeyCache(currentConfig.Cache, currentConfig.ApiKey)
+	keySource = newKeySource()
+	queue := needProcessTorrents
+	if isLive() {
+		queue = applyCachedKeys(records, needProcessTorrents)
+	}
+	sizer := newBatchSizer(currentConfig.Batch)
+	retried := make(map[string]bool)
+	failures := 0
+	for len(queue) > 0 {
+		size := sizer.size(maxBatchSize())
+		if remaining := remainingQueries(); remaining == 0 {
+			fmt.Printf("U2 query budget is used up, %d torrent(s) are left for the next run.\n", len(queue))
+			return
+		} else if remaining > 0 && size > remaining {
+			size = remaining
 		}
+		if size > len(queue) {
+			size = len(queue)
+		}
+		batch := queue[:size]
+		queue = queue[size:]
 
-		if count > 0 {
-			doMutate(records, &requestData, torrentMap)
+		missing, err := doMutate(records, batch)
+		if errors.Is(err, u2.ErrBudgetExhausted) {
+			fmt.Printf("U2 query budget is used up, %d torrent(s) are left for the next run.\n", len(batch)+len(queue))
+			return
 		}
+		if err != nil {
+			fmt.Println(err)
+			// A smaller batch is tried right away, the same size only after
+			// the client used up its retries.
+			shrunk := false
+			if errors.Is(err, u2.ErrBatchTooLarge) {
+				if shrunk = sizer.limit(len(batch) / 2); shrunk {
+					fmt.Printf("Batch size reduced to %d because U2 rejected a batch of %d.\n", len(batch)/2, len(batch))
+				}
+			} else {
+				shrunk = sizer.shrink(len(batch), "a failed request")
+			}
+			if !shrunk {
+				failures++
+				if failures > maxBatchFailures || !u2.IsRetryable(err) {
+					stopOnError(records, err)
+				}
+			}
+			if errors.Is(err, u2.ErrRateLimited) {
+				waitRateLimit(err)
+			}
+			queue = append(append([]u2.Torrent{}, batch...), queue...)
+			continue
+		}
+		failures = 0
 
-		break
+		if len(missing) == 0 {
+			sizer.success()
+			continue
+		}
+		sizer.shrink(len(batch), "a partial response")
+		for _, torrent := range missing {
+			if retried[torrent.Hash] {
+				fmt.Printf("Skip torrent %s, U2 did not answer it twice.\n", torrent.Hash)
+				continue
+			}
+			retried[torrent.Hash] = true
+			queue = append(queue, torrent)
+		}
 	}
 }
 
-func doMutate(records map[string]int, data *[]u2.U2Request, torrentMap map[int]u2.Torrent) {
-	secretKeyResponse, err := client.GetNewKey(data)
-	if err != nil {
-		fmt.Println("Error while getting new key from u2!")
-		fmt.Println(err)
-		panic(err)
+// applyCachedKeys writes the cached keys and returns the torrents that still
+// need a query.
+func applyCachedKeys(records map[string]int, torrents []u2.Torrent) []u2.Torrent {
+	if options.NoCache || !keyCache.Enabled() {
+		return torrents
+	}
+	var uncached []u2.Torrent
+	applied := 0
+	for _, torrent := range torrents {
+		key, ok := keyCache.Get(torrent.Hash)
+		if !ok {
+			uncached = append(uncached, torrent)
+			continue
+		}
+		if updateTorrent(torrent, key) {
+			records[torrent.Hash] = recordDone
+			applied++
+		}
+	}
+	if applied > 0 {
+		fmt.Printf("Used cached keys for %d torrent(s).\n", applied)
+		saveRecords(records)
 	}
-	for _, response := range *secretKeyResponse {
-		if response.Id > 0 && response.Result != "" {
-			if updateTorrent(torrentMap[response.Id], response.Result) {
-				records[(torrentMap[response.Id].Hash)] = 1
+	return uncached
+}
+
+// doMutate queries and applies the keys of one batch. It returns the torrents
+// U2 left out of its response, or the error when the whole request failed in
+// a way worth retrying, possibly with a smaller batch.
+func doMutate(records map[string]int, batch []u2.Torrent) ([]u2.Torrent, error) {
+	var missing []u2.Torrent
+	for attempt := 1; ; attempt++ {
+		hashes := make([]string, 0, len(batch))
+		for _, torrent := range batch {
+			hashes = append(hashes, torrent.Hash)
+		}
+		results, err := keySource.GetNewKey(hashes)
+		if err != nil {
+			if u2.IsRetryable(err) || u2.ShouldShrink(err) || errors.Is(err, u2.ErrBudgetExhausted) {
+				return missing, err
+			}
+			stopOnError(records, err)
+		}
+
+		var limited []u2.Torrent
+		var limitedErr error
+		for _, torrent := range batch {
+			result := results[torrent.Hash]
+			switch {
+			case result.Err == nil:
+				if isLive() {
+					keyCache.Put(torrent.Hash, result.Key)
+				}
+				if updateTorrent(torrent, result.Key) {
+					records[torrent.Hash] = recordDone
+				}
+			case errors.Is(result.Err, u2.ErrNoKey):
+				fmt.Printf("Skip torrent %s %s, no key found for it.\n", torrent.Hash, torrent.Name)
+			case errors.Is(result.Err, u2.ErrNoResponse):
+				missing = append(missing, torrent)
+			case errors.Is(result.Err, u2.ErrTorrentNotFound):
+				fmt.Printf("Torrent %s %s is deleted on U2, it won't be queried again.\n", torrent.Hash, torrent.Name)
+				records[torrent.Hash] = recordDeleted
+			case errors.Is(result.Err, u2.ErrInvalidAPIKey):
+				stopOnError(records, result.Err)
+			case errors.Is(result.Err, u2.ErrRateLimited):
+				limited = append(limited, torrent)
+				limitedErr = result.Err
+			default:
+				fmt.Printf("Skip torrent %s because of response error!\n", torrent.Hash)
+				fmt.Println(result.Err)
 			}
-		} else {
-			fmt.Println("Skip torrent because of response error!")
-			fmt.Printf("%d %s\n", response.Error.Code, response.Error.Message)
 		}
+		saveRecords(records)
+		keyCache.Save()
+
+		if len(limited) == 0 {
+			return missing, nil
+		}
+		if attempt >= maxRateLimitRetries {
+			fmt.Printf("Skip %d rate limited torrent(s), they are left for the next run.\n", len(limited))
+			return missing, nil
+		}
+		waitRateLimit(limitedErr)
+		batch = limited
 	}
+}
+
+// stopOnError ends the run, keeping the progress made so far.
+func stopOnError(records map[string]int, err error) {
 	saveRecords(records)
+	if errors.Is(err, u2.ErrInvalidAPIKey) {
+		fmt.Println("U2 rejected the API key, stop processing! Please note: API Key IS NOT passkey!")
+	} else {
+		fmt.Println("Error while getting new key from u2!")
+	}
+	fmt.Println(err)
+	panic(err)
+}
+
+func waitRateLimit(err error) {
+	wait := defaultRateLimitWait
+	var rateLimit *u2.RateLimitError
+	if errors.As(err, &rateLimit) && rateLimit.RetryAfter > 0 {
+		wait = rateLimit.RetryAfter
+	}
+	fmt.Printf("Rate limited by U2! Waiting %s before retrying.\n", wait)
+	time.Sleep(wait)
 }
 
 func updateTorrent(torrent u2.Torrent, secretKey string) bool {
-	return client.EditTorrentTracker(&torrent, toTracker+secretKey)
+	return client.EditTorrentTracker(&torrent, currentConfig.Announce.Render(secretKey))
 }
 
 func readRecords() map[string]int {
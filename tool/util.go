@@ -2,27 +2,28 @@ package tool
 
 import (
 	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
 	"os"
 	"strings"
 )
 
-func ExtractIp(host string) string {
-	host = strings.ReplaceAll(host, "http://", "")
-	host = strings.ReplaceAll(host, "https://", "")
-	host = strings.ReplaceAll(host, "/", "")
-	return host
-}
-
 func ParseTarget(target string) string {
-	target = strings.ToLower(target)
-	if strings.HasPrefix(target, "t") {
+	lowerTarget := strings.ToLower(target)
+	if strings.HasPrefix(lowerTarget, "t") {
 		return "transmission"
-	} else if strings.HasPrefix(target, "q") {
+	} else if strings.HasPrefix(lowerTarget, "q") {
 		return "qBittorrent"
-	} else if strings.HasPrefix(target, "d") {
+	} else if strings.HasPrefix(lowerTarget, "d") {
 		return "deluge"
 	}
-	return ""
+	return target
+}
+
+func PrintValidationErrors(errs u2.ValidationErrors) {
+	fmt.Println("Config invalid:")
+	for _, fieldError := range errs {
+		fmt.Printf("  %s: %s\n", fieldError.Field, fieldError.Message)
+	}
 }
 
 func KeepWindow(code int) {
@@ -0,0 +1,83 @@
+package u2
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultAnnounceTemplate = "{scheme}://{host}/announce?secure={secure}"
+	DefaultAnnounceScheme   = "https"
+)
+
+// KnownTrackerHosts lists the U2 tracker hosts, the first one is the default.
+var KnownTrackerHosts = []string{
+	"daydream.dmhy.best",
+	"tracker.dmhy.org",
+}
+
+// AnnounceConfig describes the announce URL written to torrents. Empty fields
+// fall back to the defaults.
+type AnnounceConfig struct {
+	Template string
+	Scheme   string
+	Host     string
+}
+
+func (a *AnnounceConfig) Render(secure string) string {
+	template, scheme, host := a.Template, a.Scheme, a.Host
+	if template == "" {
+		template = DefaultAnnounceTemplate
+	}
+	if scheme == "" {
+		scheme = DefaultAnnounceScheme
+	}
+	if host == "" {
+		host = KnownTrackerHosts[0]
+	}
+	return strings.NewReplacer(
+		"{scheme}", scheme,
+		"{host}", host,
+		"{secure}", url.QueryEscape(secure),
+	).Replace(template)
+}
+
+func (a *AnnounceConfig) Validate() error {
+	if a.Template != "" && !strings.Contains(a.Template, "{secure}") {
+		return fmt.Errorf("announce template %q must contain {secure}", a.Template)
+	}
+	if a.Scheme != "" && a.Scheme != "http" && a.Scheme != "https" {
+		return fmt.Errorf("announce scheme must be http or https, got %q", a.Scheme)
+	}
+
+	rendered := a.Render("0123456789abcdef")
+	announceUrl, err := url.Parse(rendered)
+	if err != nil {
+		return fmt.Errorf("announce URL %q does not parse: %v", rendered, err)
+	}
+	if announceUrl.Scheme != "http" && announceUrl.Scheme != "https" {
+		return fmt.Errorf("announce URL %q must use http or https", rendered)
+	}
+	if announceUrl.Host == "" {
+		return fmt.Errorf("announce URL %q has no host", rendered)
+	}
+	return nil
+}
+
+// RewriteAnnounceHost replaces the host of announce with host, the path and
+// the secure key are kept as they are.
+func RewriteAnnounceHost(announce string, host string) (string, error) {
+	if host == "" || strings.ContainsAny(host, "/?#@") {
+		return "", fmt.Errorf("invalid tracker host %q", host)
+	}
+	announceUrl, err := url.Parse(announce)
+	if err != nil {
+		return "", fmt.Errorf("announce URL %q does not parse: %v", announce, err)
+	}
+	if announceUrl.Query().Get("secure") == "" {
+		return "", fmt.Errorf("announce URL %q has no secure key", announce)
+	}
+	announceUrl.Host = host
+	return announceUrl.String(), nil
+}
@@ -0,0 +1,98 @@
+package u2
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultApiUrl = "https://u2.dmhy.org"
+	apiPath       = "/jsonrpc_torrentkey.php"
+	apiKeyHeader  = "X-Api-Key"
+)
+
+// Where the API key is sent. U2 only documents the query string, where the
+// key may end up in the logs of proxies on the way. The header and the body
+// are experimental: the X-Api-Key header and the apikey member are not part of
+// the U2 API and only work with servers that read them, e.g. a proxy in front
+// of U2 or the mock.
+const (
+	ApiKeyInQuery  = "query"
+	ApiKeyInHeader = "header"
+	ApiKeyInBody   = "body"
+)
+
+var ApiKeyPlaces = []string{ApiKeyInQuery, ApiKeyInHeader, ApiKeyInBody}
+
+// ApiEndpoint returns the URL of the key API. ApiUrl is either the base URL of
+// the site or, when it ends with .php, the API itself.
+func (c *Config) ApiEndpoint() string {
+	base := c.ApiUrl
+	if base == "" {
+		base = DefaultApiUrl
+	}
+	if apiUrl, err := url.Parse(base); err == nil && strings.HasSuffix(apiUrl.Path, ".php") {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + apiPath
+}
+
+func ValidateApiUrl(value string) error {
+	if value == "" {
+		return nil
+	}
+	apiUrl, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid API URL %q: %v", value, err)
+	}
+	if apiUrl.Scheme != "http" && apiUrl.Scheme != "https" {
+		return fmt.Errorf("API URL %q must use http or https", value)
+	}
+	if apiUrl.Host == "" {
+		return fmt.Errorf("API URL %q has no host", value)
+	}
+	return nil
+}
+
+// ValidateApiKeyIn checks the API key place for the API at apiUrl. U2 itself
+// only reads the key from the query, so the experimental places need another
+// server.
+func ValidateApiKeyIn(value string, apiUrl string) error {
+	if value == "" || value == ApiKeyInQuery {
+		return nil
+	}
+	if value != ApiKeyInHeader && value != ApiKeyInBody {
+		return fmt.Errorf("unknown API key place %q, expected one of %s", value, strings.Join(ApiKeyPlaces, ", "))
+	}
+	if isDefaultApi(apiUrl) {
+		return fmt.Errorf("U2 only reads the API key from the query, the %s only works with another API URL", value)
+	}
+	return nil
+}
+
+// isDefaultApi reports whether apiUrl points to the host of DefaultApiUrl.
+func isDefaultApi(apiUrl string) bool {
+	if apiUrl == "" {
+		return true
+	}
+	parsed, err := url.Parse(apiUrl)
+	defaultUrl, _ := url.Parse(DefaultApiUrl)
+	return err == nil && strings.EqualFold(parsed.Hostname(), defaultUrl.Hostname())
+}
+
+// apiRequestUrl returns the URL to post to, with the API key in the query
+// string unless it goes elsewhere.
+func (c *Client) apiRequestUrl() (string, error) {
+	if c.config.ApiKeyIn != "" && c.config.ApiKeyIn != ApiKeyInQuery {
+		return c.endpoint, nil
+	}
+	apiUrl, err := url.Parse(c.endpoint)
+	if err != nil {
+		return "", err
+	}
+	query := apiUrl.Query()
+	query.Set("apikey", c.config.ApiKey)
+	apiUrl.RawQuery = query.Encode()
+	return apiUrl.String(), nil
+}
@@ -0,0 +1,26 @@
+package u2
+
+import "testing"
+
+func TestValidateApiKeyIn(t *testing.T) {
+	tests := []struct {
+		value  string
+		apiUrl string
+		valid  bool
+	}{
+		{"", "", true},
+		{ApiKeyInQuery, "", true},
+		{ApiKeyInQuery, DefaultApiUrl, true},
+		{ApiKeyInHeader, "", false},
+		{ApiKeyInBody, DefaultApiUrl, false},
+		{ApiKeyInHeader, "HTTPS://U2.dmhy.org:443/jsonrpc_torrentkey.php", false},
+		{ApiKeyInHeader, "http://127.0.0.1:8080", true},
+		{ApiKeyInBody, "https://u2-proxy.example.com/", true},
+		{"cookie", "http://127.0.0.1:8080", false},
+	}
+	for _, test := range tests {
+		if err := ValidateApiKeyIn(test.value, test.apiUrl); (err == nil) != test.valid {
+			t.Errorf("ValidateApiKeyIn(%q, %q) = %v, want valid %v", test.value, test.apiUrl, err, test.valid)
+		}
+	}
+}
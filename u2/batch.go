@@ -0,0 +1,60 @@
+package u2
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	DefaultBatchSize    = 100
+	DefaultMinBatchSize = 10
+
+	// maxBatchSizeHeader is a hypothetical header for the largest batch U2
+	// accepts. U2 does not document or send it, it is only read in case it
+	// ever does. Oversized batches are found from the errors instead.
+	maxBatchSizeHeader = "X-Max-Batch-Size"
+)
+
+// BatchConfig sets how many torrents are queried in one request. Batches
+// shrink down to MinSize when requests fail and grow back up to Size.
+type BatchConfig struct {
+	Size    int
+	MinSize int
+}
+
+func (b *BatchConfig) Validate() error {
+	if b.Size < 0 || b.MinSize < 0 {
+		return fmt.Errorf("batch sizes must not be negative")
+	}
+	if b.Size != 0 && b.MinSize > b.Size {
+		return fmt.Errorf("minimum batch size %d is larger than batch size %d", b.MinSize, b.Size)
+	}
+	return nil
+}
+
+// Sizes returns the configured size and minimum size with defaults applied.
+func (b *BatchConfig) Sizes() (int, int) {
+	size, minSize := b.Size, b.MinSize
+	if size == 0 {
+		size = DefaultBatchSize
+	}
+	if minSize == 0 {
+		minSize = DefaultMinBatchSize
+	}
+	if minSize > size {
+		minSize = size
+	}
+	return size, minSize
+}
+
+// MaxBatchSize is the largest batch U2 advertised so far, 0 if it didn't.
+func (c *Client) MaxBatchSize() int {
+	return c.maxBatchSize
+}
+
+func (c *Client) readMaxBatchSize(header http.Header) {
+	if value, err := strconv.Atoi(header.Get(maxBatchSizeHeader)); err == nil && value > 0 {
+		c.maxBatchSize = value
+	}
+}
@@ -0,0 +1,124 @@
+package u2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const DefaultBudgetStateFile = "budget.json"
+
+// BudgetConfig caps the torrents queried from U2 per run, per hour and per
+// day, 0 for no cap. With an hourly or daily cap, usage is saved to StateFile
+// so that every run on this machine counts against the same hour and day.
+type BudgetConfig struct {
+	PerRun    int
+	PerHour   int
+	PerDay    int
+	StateFile string
+}
+
+func (b *BudgetConfig) Validate() error {
+	if b.PerRun < 0 || b.PerHour < 0 || b.PerDay < 0 {
+		return fmt.Errorf("query budgets must not be negative")
+	}
+	return nil
+}
+
+type budgetUsage struct {
+	Time    time.Time
+	Queries int
+}
+
+// Budget counts the queries sent to U2 against a BudgetConfig.
+type Budget struct {
+	config BudgetConfig
+	path   string
+	run    int
+	usage  []budgetUsage
+}
+
+func NewBudget(config BudgetConfig) *Budget {
+	budget := &Budget{config: config, path: config.StateFile}
+	if budget.path == "" {
+		budget.path = DefaultBudgetStateFile
+	}
+	if !budget.saved() {
+		return budget
+	}
+	if data, err := ioutil.ReadFile(budget.path); err == nil {
+		_ = json.Unmarshal(data, &budget.usage)
+	}
+	return budget
+}
+
+// saved reports whether usage is kept in the state file, which only the
+// hourly and daily caps need.
+func (b *Budget) saved() bool {
+	return b.config.PerHour > 0 || b.config.PerDay > 0
+}
+
+// Remaining returns how many torrents may still be queried now, -1 when there
+// is no cap.
+func (b *Budget) Remaining() int {
+	now := time.Now()
+	remaining := -1
+	limit := func(max, used int) {
+		if max == 0 {
+			return
+		}
+		left := max - used
+		if left < 0 {
+			left = 0
+		}
+		if remaining < 0 || left < remaining {
+			remaining = left
+		}
+	}
+	limit(b.config.PerRun, b.run)
+	limit(b.config.PerHour, b.usedSince(now.Add(-time.Hour)))
+	limit(b.config.PerDay, b.usedSince(now.Add(-24*time.Hour)))
+	return remaining
+}
+
+func (b *Budget) usedSince(since time.Time) int {
+	used := 0
+	for _, usage := range b.usage {
+		if usage.Time.After(since) {
+			used += usage.Queries
+		}
+	}
+	return used
+}
+
+// Use records queries sent now and saves the usage of the last day.
+func (b *Budget) Use(queries int) {
+	b.run += queries
+	if !b.saved() {
+		return
+	}
+	now := time.Now()
+	kept := b.usage[:0]
+	for _, usage := range b.usage {
+		if usage.Time.After(now.Add(-24 * time.Hour)) {
+			kept = append(kept, usage)
+		}
+	}
+	b.usage = append(kept, budgetUsage{Time: now, Queries: queries})
+
+	data, err := json.Marshal(b.usage)
+	if err == nil {
+		err = ioutil.WriteFile(b.path, data, os.FileMode(0644))
+	}
+	if err != nil {
+		fmt.Printf("Saving query budget to %s failed: %v\n", b.path, err)
+	}
+}
+
+// RemainingQueries returns how many torrents may still be queried from U2 in
+// this run, -1 when no budget is set.
+func (c *Client) RemainingQueries() int {
+	return c.budget.Remaining()
+}
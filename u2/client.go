@@ -2,137 +2,227 @@ package u2
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
-	"strconv"
+	"sort"
 	"sync"
 	"time"
 )
 
+const apiTimeout = 60 * time.Second
+
 var (
-	driversMu  sync.RWMutex
-	drivers    = make(map[string]Driver)
-	endpoint   = "https://u2.dmhy.org/jsonrpc_torrentkey.php?apikey="
-	httpClient = &http.Client{}
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
 )
 
 type Driver interface {
 	NewClient(*Config) (DriverClient, error)
+
+	DefaultPort() uint16
 }
 
 type DriverClient interface {
 	Check() (bool, error)
 
-	GetTorrentList(tracker string) *[]Torrent
+	GetTorrentList(matcher *TrackerMatcher) *[]Torrent
+
+	// GetUntrackedTorrents lists the torrents without a matching tracker.
+	// Drivers reuse the list of the last GetTorrentList with the same
+	// matcher instead of fetching it again.
+	GetUntrackedTorrents(matcher *TrackerMatcher) *[]TorrentMeta
 
 	EditTorrentTracker(torrent *Torrent, newTracker string) (bool, error)
+
+	// Close releases the connection to the client.
+	Close() error
 }
 
 type Client struct {
 	config     *Config
 	realClient *DriverClient
+	httpClient *http.Client
+	limiter    *TokenBucket
+	budget     *Budget
+	random     *rand.Rand
+	endpoint   string
+
+	maxBatchSize int
 }
 
-func (c *Client) GetNewKey(data *[]U2Request) (*[]U2Response, error) {
-	retryCount := 0
-	jsonRequestBytes, err := json.Marshal(data)
+// GetNewKey asks U2 for the secure keys of hashes in one batch. Each hash gets
+// a KeyResult, whose Err is a *U2Error or ErrNoResponse when U2 answered the
+// batch but not this hash. It fails with ErrBudgetExhausted instead of going
+// over the query budget.
+func (c *Client) GetNewKey(hashes []string) (map[string]KeyResult, error) {
+	requests := make([]U2Request, 0, len(hashes))
+	for i, hash := range hashes {
+		requests = append(requests, U2Request{
+			JsonRpc: jsonRpcVersion,
+			Method:  "query",
+			Params:  []string{hash},
+			Id:      i + 1,
+		})
+		if c.config.ApiKeyIn == ApiKeyInBody {
+			requests[i].ApiKey = c.config.ApiKey
+		}
+	}
+
+	_, minSize := c.config.Batch.Sizes()
+	responses, err := c.batchCall(requests, len(hashes) > minSize)
 	if err != nil {
-		fmt.Println("Process u2 request failed!")
-		fmt.Println(err)
 		return nil, err
 	}
+	return keyResults(requests, responses), nil
+}
 
-	for {
-		req, err := http.NewRequest("POST", endpoint+c.config.ApiKey, bytes.NewBuffer(jsonRequestBytes))
-		if err != nil {
-			fmt.Println("Process u2 request failed!")
-			fmt.Println(err)
+// post sends a request body to the U2 API and returns the response body.
+// Rate limits, server errors and network errors are retried with backoff.
+// When shrinkable, the errors a smaller batch may avoid are returned at once
+// so the caller can retry with one. Every request sent, retries included, is
+// charged queries against the budget, and ErrBudgetExhausted is returned
+// instead of going over it.
+func (c *Client) post(jsonRequestBytes []byte, queries int, shrinkable bool) ([]byte, error) {
+	maxRetries := c.config.Retry.maxRetries()
+	for attempt := 0; ; attempt++ {
+		if remaining := c.budget.Remaining(); remaining >= 0 && queries > remaining {
+			return nil, ErrBudgetExhausted
+		}
+		c.limiter.Wait()
+		body, retryAfter, err := c.postOnce(jsonRequestBytes, queries)
+		if err == nil {
+			return body, nil
+		}
+		if !IsRetryable(err) || (shrinkable && ShouldShrink(err)) {
 			return nil, err
 		}
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			fmt.Println("Process u2 request failed!")
-			fmt.Println(err)
+		if attempt >= maxRetries {
+			fmt.Println("Too many retried! Please check your network!")
 			return nil, err
 		}
 
-		fmt.Println("response Status:", resp.Status)
-		if resp.StatusCode == 200 {
-			body, _ := ioutil.ReadAll(resp.Body)
-			closeBody(resp)
-
-			var secretKeyResponse []U2Response
-
-			err := json.Unmarshal(body, &secretKeyResponse)
-			if err != nil {
-				fmt.Println("Error while processing u2 response!")
-				return nil, err
-			} else {
-				return &secretKeyResponse, nil
-			}
+		wait := c.config.Retry.backoff(attempt, retryAfter, c.random)
+		if errors.Is(err, ErrRateLimited) {
+			fmt.Printf("Rate limit! Waiting %s!\n", wait.Round(time.Second))
 		} else {
-			if resp.StatusCode == 503 {
-				retryAfter := resp.Header.Get("Retry-After")
-				waitSecond := 5
-				if retryAfter != "" {
-					retryAfterInt, err := strconv.Atoi(retryAfter)
-					if err != nil {
-						fmt.Println("Convert retry after failed! Use default wait time!")
-					} else {
-						waitSecond += retryAfterInt
-					}
-				}
-				fmt.Printf("Rate limit! Waiting %d seconds!\n", waitSecond)
-				time.Sleep(time.Duration(waitSecond) * time.Second)
-			} else if resp.StatusCode == 403 {
-				fmt.Println("Wrong API key! Please note: API Key IS NOT passkey!")
-				if resp.Body != nil {
-					body, _ := ioutil.ReadAll(resp.Body)
-					fmt.Println(string(body))
-				}
-				return nil, fmt.Errorf("Wrong API key!")
-			} else {
-				fmt.Println("Unrecognized error! Retry after 5 seconds!")
-				if resp.Body != nil {
-					body, _ := ioutil.ReadAll(resp.Body)
-					fmt.Println(string(body))
-				}
-				time.Sleep(5 * time.Second)
-			}
-			retryCount++
+			fmt.Println(err)
+			fmt.Printf("Retry after %s!\n", wait.Round(time.Second))
 		}
+		time.Sleep(wait)
+	}
+}
+
+// postOnce sends one request and charges its queries against the budget. On
+// 429 and 503 it returns the Retry-After wait together with a *RateLimitError.
+func (c *Client) postOnce(jsonRequestBytes []byte, queries int) ([]byte, time.Duration, error) {
+	requestUrl, err := c.apiRequestUrl()
+	if err != nil {
+		fmt.Println("Invalid U2 API URL!")
+		return nil, 0, err
+	}
+	req, err := http.NewRequest("POST", requestUrl, bytes.NewBuffer(jsonRequestBytes))
+	if err != nil {
+		fmt.Println("Process u2 request failed!")
+		fmt.Println(err)
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.ApiKeyIn == ApiKeyInHeader {
+		req.Header.Set(apiKeyHeader, c.config.ApiKey)
+	}
 
-		closeBody(resp)
+	c.budget.Use(queries)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		fmt.Println("Process u2 request failed!")
+		return nil, 0, &networkError{err: err}
+	}
+	defer closeBody(resp)
+	c.readMaxBatchSize(resp.Header)
 
-		if retryCount > 5 {
-			fmt.Println("Too many retried! Please check your network!")
-			break
-		}
+	fmt.Println("response Status:", resp.Status)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Println("Error while reading u2 response!")
+		return nil, 0, &networkError{err: err}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return body, 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		retryAfter := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return nil, retryAfter, &RateLimitError{RetryAfter: retryAfter, StatusCode: resp.StatusCode}
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized:
+		fmt.Println("Wrong API key! Please note: API Key IS NOT passkey!")
+		fmt.Println(string(body))
+		return nil, 0, ErrInvalidAPIKey
+	case resp.StatusCode == http.StatusRequestEntityTooLarge:
+		return nil, 0, fmt.Errorf("%w: %s", ErrBatchTooLarge, resp.Status)
+	case resp.StatusCode >= 500:
+		fmt.Println("U2 server error!")
+		fmt.Println(string(body))
+		return nil, 0, fmt.Errorf("%w: %s", ErrServer, resp.Status)
+	default:
+		fmt.Println("Unrecognized error!")
+		fmt.Println(string(body))
+		return nil, 0, fmt.Errorf("unexpected U2 response %s", resp.Status)
 	}
-	return nil, fmt.Errorf("Failed after %d retries!", retryCount)
 }
 
+// ErrNoDriver is returned by the torrent client methods of a Client made by
+// NewU2KeySource, which has no torrent client.
+var ErrNoDriver = errors.New("no torrent client")
+
 func (c *Client) Check() (bool, error) {
+	if c.realClient == nil {
+		return false, ErrNoDriver
+	}
 	return (*c.realClient).Check()
 }
 
-func (c *Client) GetTorrentList(tracker string) *[]Torrent {
-	return (*c.realClient).GetTorrentList(tracker)
+func (c *Client) GetTorrentList(matcher *TrackerMatcher) *[]Torrent {
+	if c.realClient == nil {
+		fmt.Println(ErrNoDriver)
+		return &[]Torrent{}
+	}
+	return (*c.realClient).GetTorrentList(matcher)
+}
+
+func (c *Client) GetUntrackedTorrents(matcher *TrackerMatcher) *[]TorrentMeta {
+	if c.realClient == nil {
+		fmt.Println(ErrNoDriver)
+		return &[]TorrentMeta{}
+	}
+	return (*c.realClient).GetUntrackedTorrents(matcher)
 }
 
 func (c *Client) EditTorrentTracker(torrent *Torrent, newTracker string) bool {
+	if c.realClient == nil {
+		fmt.Println(ErrNoDriver)
+		return false
+	}
 	ok, err := (*c.realClient).EditTorrentTracker(torrent, newTracker)
 	if err != nil {
-		fmt.Println("Error while edit torrent %s", torrent.Hash)
+		fmt.Printf("Error while edit torrent %s\n", torrent.Hash)
 	}
 	return ok
 }
 
+func (c *Client) Close() {
+	if c.realClient == nil {
+		return
+	}
+	if err := (*c.realClient).Close(); err != nil {
+		fmt.Println("Error while closing the client connection!")
+		fmt.Println(err)
+	}
+}
+
 func Register(name string, driver Driver) {
 	driversMu.Lock()
 	defer driversMu.Unlock()
@@ -145,6 +235,34 @@ func Register(name string, driver Driver) {
 	drivers[name] = driver
 }
 
+func HasDriver(name string) bool {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	_, ok := drivers[name]
+	return ok
+}
+
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func DefaultPort(name string) uint16 {
+	driversMu.RLock()
+	driverI, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return 0
+	}
+	return driverI.DefaultPort()
+}
+
 func NewClient(config *Config) (*Client, error) {
 	driversMu.RLock()
 	driverI, ok := drivers[config.Target]
@@ -162,10 +280,28 @@ func NewClient(config *Config) (*Client, error) {
 }
 
 func newClient(config *Config, realClient *DriverClient) (*Client, error) {
-	setHttpProxy(config.Proxy)
+	httpClient, err := config.ApiHTTPClient(apiTimeout)
+	if err != nil {
+		fmt.Println("Invalid TLS or proxy config for U2 API!")
+		return nil, err
+	}
+	if config.ApiUrl != "" {
+		fmt.Printf("Using U2 API %s!\n", config.ApiEndpoint())
+	}
+	if config.Proxy != "" && config.Proxy != ProxyDirect {
+		fmt.Printf("Using proxy %s for U2 request!\n", redactProxy(config.Proxy))
+	}
+	if config.ApiKeyIn != "" && config.ApiKeyIn != ApiKeyInQuery {
+		fmt.Printf("Sending the API key in the %s is experimental, make sure %s reads it!\n", config.ApiKeyIn, config.ApiEndpoint())
+	}
 	return &Client{
 		config:     config,
 		realClient: realClient,
+		httpClient: httpClient,
+		limiter:    NewTokenBucket(config.RateLimit),
+		budget:     NewBudget(config.Budget),
+		endpoint:   config.ApiEndpoint(),
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
 	}, nil
 }
 
@@ -175,15 +311,11 @@ func closeBody(resp *http.Response) {
 	}
 }
 
-func setHttpProxy(proxy string) {
-	if proxy != "" {
-		proxyUrl, err := url.Parse(proxy)
-		if err != nil {
-			fmt.Println("Invalid proxy config")
-			fmt.Println(err)
-		} else {
-			httpClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyUrl)}}
-			fmt.Printf("Using proxy %s for U2 request!\n", proxy)
-		}
+func redactProxy(proxy string) string {
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil || proxyUrl.User == nil {
+		return proxy
 	}
+	proxyUrl.User = url.User(proxyUrl.User.Username())
+	return proxyUrl.String()
 }
@@ -0,0 +1,258 @@
+package u2_test
+
+import (
+	"errors"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"github.com/i0range/U2KeyResetTool/u2test"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testApiKey = "0123456789abcdef"
+
+var testHashes = []string{
+	"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+	"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+	"cccccccccccccccccccccccccccccccccccccccc",
+	"dddddddddddddddddddddddddddddddddddddddd",
+}
+
+// testConfig returns a config for the API at apiUrl that does not wait
+// between requests and keeps its state files in a temporary directory.
+func testConfig(t *testing.T, apiUrl string) *u2.Config {
+	dir, err := ioutil.TempDir("", "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return &u2.Config{
+		ApiKey:    testApiKey,
+		ApiUrl:    apiUrl,
+		RateLimit: u2.RateLimitConfig{RequestsPerMinute: 60000, Burst: 100, StateFile: filepath.Join(dir, "ratelimit.json")},
+		Retry:     u2.RetryConfig{MaxRetries: 2, InitialWait: u2.Duration(10 * time.Millisecond), MaxWait: u2.Duration(20 * time.Millisecond)},
+		Budget:    u2.BudgetConfig{StateFile: filepath.Join(dir, "budget.json")},
+	}
+}
+
+// newTestSource starts a mock and returns a key source querying it. Batches
+// of up to minBatch torrents are retried at the same size.
+func newTestSource(t *testing.T, config u2test.Config, minBatch int) (*u2.Client, *u2test.Handler) {
+	handler := u2test.NewHandler(config)
+	sourceConfig := testConfig(t, serve(t, handler))
+	sourceConfig.Batch = u2.BatchConfig{Size: 100, MinSize: minBatch}
+	source, err := u2.NewU2KeySource(sourceConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source, handler
+}
+
+// serve starts handler on a local port and returns its URL.
+func serve(t *testing.T, handler *u2test.Handler) string {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func checkKeys(t *testing.T, results map[string]u2.KeyResult, hashes ...string) {
+	t.Helper()
+	for _, hash := range hashes {
+		if result := results[hash]; result.Err != nil || result.Key != u2test.Key(hash) {
+			t.Errorf("result of %s = %+v, want key %s", hash, result, u2test.Key(hash))
+		}
+	}
+}
+
+func TestGetNewKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		config u2test.Config
+		keys   []string
+		noResp []string
+	}{
+		{"in order", u2test.Config{}, testHashes, nil},
+		{"shuffled", u2test.Config{Shuffle: true}, testHashes, nil},
+		{"dropped", u2test.Config{Drop: 2}, []string{testHashes[0], testHashes[2]}, []string{testHashes[1], testHashes[3]}},
+		{"extra", u2test.Config{Extra: true}, testHashes, nil},
+		{"shuffled, dropped and extra", u2test.Config{Shuffle: true, Drop: 3, Extra: true}, []string{testHashes[0], testHashes[1], testHashes[3]}, []string{testHashes[2]}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.ApiKey = testApiKey
+			source, handler := newTestSource(t, test.config, 1)
+			results, err := source.GetNewKey(testHashes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(testHashes) {
+				t.Errorf("got %d results, want %d", len(results), len(testHashes))
+			}
+			checkKeys(t, results, test.keys...)
+			for _, hash := range test.noResp {
+				if result := results[hash]; !errors.Is(result.Err, u2.ErrNoResponse) {
+					t.Errorf("result of %s = %+v, want ErrNoResponse", hash, result)
+				}
+			}
+			if handler.Requests() != 1 {
+				t.Errorf("sent %d requests, want 1", handler.Requests())
+			}
+		})
+	}
+}
+
+func TestGetNewKeyErrors(t *testing.T) {
+	source, _ := newTestSource(t, u2test.Config{
+		ApiKey: testApiKey,
+		Errors: map[string]u2.U2Error{
+			// The mock matches hashes in any case.
+			strings.ToUpper(testHashes[0]): u2test.NotFoundError,
+			testHashes[1]:                  u2test.InvalidParamsError,
+			testHashes[2]:                  {Code: -32001, Message: "gone"},
+		},
+	}, 1)
+	results, err := source.GetNewKey(testHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := results[testHashes[0]]; !errors.Is(result.Err, u2.ErrTorrentNotFound) {
+		t.Errorf("result of not found = %+v, want ErrTorrentNotFound", result)
+	}
+	// The standard code decides, so a torrent is never marked deleted because
+	// of the message of an invalid params error.
+	if result := results[testHashes[1]]; !errors.Is(result.Err, u2.ErrInvalidRequest) || errors.Is(result.Err, u2.ErrTorrentNotFound) {
+		t.Errorf("result of invalid params = %+v, want ErrInvalidRequest", result)
+	}
+	if result := results[testHashes[2]]; !errors.Is(result.Err, u2.ErrServer) {
+		t.Errorf("result of an unknown server error = %+v, want ErrServer", result)
+	}
+	checkKeys(t, results, testHashes[3])
+}
+
+func TestGetNewKeySingleObjectError(t *testing.T) {
+	source, handler := newTestSource(t, u2test.Config{
+		ApiKey:     testApiKey,
+		BatchError: &u2.U2Error{Code: u2.CodeParseError, Message: "Parse error"},
+	}, 1)
+	results, err := source.GetNewKey(testHashes)
+	var u2Err *u2.U2Error
+	if !errors.As(err, &u2Err) || u2Err.Code != u2.CodeParseError || !errors.Is(err, u2.ErrInvalidRequest) {
+		t.Fatalf("GetNewKey = %v, %v, want the parse error", results, err)
+	}
+	if u2.IsRetryable(err) || u2.ShouldShrink(err) {
+		t.Errorf("parse error %v is retried", err)
+	}
+	if handler.Requests() != 1 {
+		t.Errorf("sent %d requests, want 1", handler.Requests())
+	}
+}
+
+func TestGetNewKeyUnavailable(t *testing.T) {
+	config := u2test.Config{ApiKey: testApiKey, Unavailable: 1, RetryAfter: time.Second}
+
+	// A batch at the minimum size is retried after Retry-After.
+	source, handler := newTestSource(t, config, len(testHashes))
+	start := time.Now()
+	results, err := source.GetNewKey(testHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, results, testHashes...)
+	if handler.Requests() != 2 {
+		t.Errorf("sent %d requests, want 2", handler.Requests())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want Retry-After of 1s", elapsed)
+	}
+
+	// A larger batch fails at once so that a smaller one can be tried.
+	source, handler = newTestSource(t, config, 1)
+	_, err = source.GetNewKey(testHashes)
+	var rateLimit *u2.RateLimitError
+	if !errors.As(err, &rateLimit) || rateLimit.RetryAfter != time.Second || !u2.ShouldShrink(err) {
+		t.Fatalf("GetNewKey error = %v, want 503 with Retry-After", err)
+	}
+	if handler.Requests() != 1 {
+		t.Errorf("sent %d requests, want 1", handler.Requests())
+	}
+}
+
+func TestGetNewKeyForbidden(t *testing.T) {
+	handler := u2test.NewHandler(u2test.Config{ApiKey: "another key"})
+	source, err := u2.NewU2KeySource(testConfig(t, serve(t, handler)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.GetNewKey(testHashes); !errors.Is(err, u2.ErrInvalidAPIKey) {
+		t.Fatalf("GetNewKey error = %v, want ErrInvalidAPIKey", err)
+	}
+	if handler.Requests() != 1 {
+		t.Errorf("sent %d requests, want 1", handler.Requests())
+	}
+}
+
+func TestGetNewKeyOversizedBatch(t *testing.T) {
+	source, handler := newTestSource(t, u2test.Config{ApiKey: testApiKey, MaxBatchSize: 2}, 1)
+	_, err := source.GetNewKey(testHashes[:3])
+	if !errors.Is(err, u2.ErrBatchTooLarge) || !u2.ShouldShrink(err) || u2.IsRetryable(err) {
+		t.Fatalf("GetNewKey error = %v, want ErrBatchTooLarge", err)
+	}
+	if source.MaxBatchSize() != 0 {
+		t.Errorf("MaxBatchSize = %d, want 0 as the mock does not advertise it", source.MaxBatchSize())
+	}
+	results, err := source.GetNewKey(testHashes[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, results, testHashes[:2]...)
+	if handler.Requests() != 2 {
+		t.Errorf("sent %d requests, want 2", handler.Requests())
+	}
+}
+
+func TestGetNewKeyBudget(t *testing.T) {
+	tests := []struct {
+		name      string
+		budget    u2.BudgetConfig
+		err       error
+		requests  int
+		remaining int
+	}{
+		// The failed try counts against the budget as well.
+		{"retried", u2.BudgetConfig{PerRun: 8}, nil, 2, 0},
+		{"exhausted by the retry", u2.BudgetConfig{PerRun: 6}, u2.ErrBudgetExhausted, 1, 2},
+		{"exhausted before", u2.BudgetConfig{PerRun: 3}, u2.ErrBudgetExhausted, 0, 3},
+		{"hourly", u2.BudgetConfig{PerHour: 10}, nil, 2, 2},
+		{"unlimited", u2.BudgetConfig{}, nil, 2, -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := u2test.NewHandler(u2test.Config{ApiKey: testApiKey, Unavailable: 1})
+			config := testConfig(t, serve(t, handler))
+			config.Batch = u2.BatchConfig{Size: 100, MinSize: len(testHashes)}
+			test.budget.StateFile = config.Budget.StateFile
+			config.Budget = test.budget
+			source, err := u2.NewU2KeySource(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := source.GetNewKey(testHashes); !errors.Is(err, test.err) {
+				t.Fatalf("GetNewKey error = %v, want %v", err, test.err)
+			}
+			if handler.Requests() != test.requests {
+				t.Errorf("sent %d requests, want %d", handler.Requests(), test.requests)
+			}
+			if remaining := source.RemainingQueries(); remaining != test.remaining {
+				t.Errorf("RemainingQueries = %d, want %d", remaining, test.remaining)
+			}
+			_, err = os.Stat(config.Budget.StateFile)
+			if saved := test.budget.PerHour > 0; saved == os.IsNotExist(err) {
+				t.Errorf("state file saved = %v, want %v", !os.IsNotExist(err), saved)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package u2
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ParseConnectionUrl parses a connection string such as
+// qbittorrent+https://user:pass@[::1]:8080/qbit/ or transmission://host:9091/custom/.
+// When the scheme names no driver, defaultTarget is used, so a plain WebUI URL
+// like https://box.example/qbit/ is accepted too. Without a port, an http or
+// https URL uses 80 or 443 and a bare driver scheme the default port of the
+// driver. The path becomes BasePath.
+func ParseConnectionUrl(raw string, defaultTarget string) (*Config, error) {
+	connectionUrl, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, err
+	}
+	if connectionUrl.Host == "" {
+		return nil, fmt.Errorf("connection URL %q has no host", raw)
+	}
+
+	config := &Config{Target: defaultTarget}
+	scheme := strings.ToLower(connectionUrl.Scheme)
+	webScheme := true
+	if index := strings.Index(scheme, "+"); index >= 0 {
+		config.Target = driverName(scheme[:index])
+		scheme = scheme[index+1:]
+	} else if name := driverName(scheme); name != "" {
+		config.Target = name
+		scheme = "http"
+		webScheme = false
+	}
+	switch scheme {
+	case "http":
+	case "https":
+		config.Secure = true
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q in connection URL", connectionUrl.Scheme)
+	}
+
+	config.Host = connectionUrl.Hostname()
+	if portString := connectionUrl.Port(); portString != "" {
+		port, err := strconv.ParseUint(portString, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q in connection URL", portString)
+		}
+		config.Port = uint16(port)
+	} else if !webScheme {
+		config.Port = DefaultPort(config.Target)
+	} else if config.Secure {
+		config.Port = 443
+	} else {
+		config.Port = 80
+	}
+	if connectionUrl.User != nil {
+		config.User = connectionUrl.User.Username()
+		config.Pass, _ = connectionUrl.User.Password()
+	}
+	if connectionUrl.Path != "/" {
+		config.BasePath = connectionUrl.Path
+	}
+	return config, nil
+}
+
+// ConnectionUrl formats the client connection of c without the password.
+func (c *Config) ConnectionUrl() string {
+	scheme := "http"
+	if c.Secure {
+		scheme = "https"
+	}
+	connectionUrl := url.URL{
+		Scheme: strings.ToLower(c.Target) + "+" + scheme,
+		Host:   c.Address(),
+		Path:   c.BasePath,
+	}
+	if c.User != "" {
+		connectionUrl.User = url.User(c.User)
+	}
+	return connectionUrl.String()
+}
+
+// Address joins host and port, adding brackets around IPv6 literals.
+func (c *Config) Address() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(int(c.Port)))
+}
+
+// UrlHost returns the host ready to be put into a URL or a host:port pair.
+func (c *Config) UrlHost() string {
+	if strings.Contains(c.Host, ":") {
+		return "[" + c.Host + "]"
+	}
+	return c.Host
+}
+
+func driverName(name string) string {
+	for _, driverName := range Drivers() {
+		if strings.EqualFold(driverName, name) {
+			return driverName
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package u2
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fingerprinter is implemented by drivers that can recognise their client on
+// a host without credentials. Fingerprint returns nil when nothing matching the
+// driver answers on port.
+type Fingerprinter interface {
+	DiscoveryPorts() []uint16
+
+	Fingerprint(host string, port uint16, timeout time.Duration) *Config
+}
+
+// Discover probes host on the well-known ports of every registered driver and
+// returns a connection config for each client found.
+func Discover(host string, timeout time.Duration) []Config {
+	driversMu.RLock()
+	fingerprinters := make(map[string]Fingerprinter)
+	for name, driver := range drivers {
+		if fingerprinter, ok := driver.(Fingerprinter); ok {
+			fingerprinters[name] = fingerprinter
+		}
+	}
+	driversMu.RUnlock()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		found   []Config
+		visited = make(map[string]bool)
+	)
+	for _, fingerprinter := range fingerprinters {
+		for _, port := range fingerprinter.DiscoveryPorts() {
+			wg.Add(1)
+			go func(fingerprinter Fingerprinter, port uint16) {
+				defer wg.Done()
+				config := fingerprinter.Fingerprint(host, port, timeout)
+				if config == nil {
+					return
+				}
+
+				key := fmt.Sprintf("%s|%s|%d", config.Target, config.Host, config.Port)
+				mu.Lock()
+				defer mu.Unlock()
+				if !visited[key] {
+					visited[key] = true
+					found = append(found, *config)
+				}
+			}(fingerprinter, port)
+		}
+	}
+	wg.Wait()
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Target != found[j].Target {
+			return found[i].Target < found[j].Target
+		}
+		return found[i].Port < found[j].Port
+	})
+	return found
+}
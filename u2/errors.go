@@ -0,0 +1,132 @@
+package u2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidAPIKey   = errors.New("invalid U2 API key")
+	ErrRateLimited     = errors.New("rate limited by U2")
+	ErrTorrentNotFound = errors.New("torrent not found on U2")
+	ErrServer          = errors.New("U2 server error")
+	ErrInvalidRequest  = errors.New("invalid request to U2")
+	ErrBatchTooLarge   = errors.New("batch too large for U2")
+	ErrBudgetExhausted = errors.New("U2 query budget exhausted")
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// RateLimitError is ErrRateLimited with the wait time U2 asked for, zero when
+// it did not say, and the HTTP status, 429 or 503.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	StatusCode int
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%v, retry after %s", ErrRateLimited, e.RetryAfter)
+	}
+	return ErrRateLimited.Error()
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// Unwrap maps the error to one of the Err values, so errors.Is works on it.
+// The standard JSON-RPC codes decide first. Only for the other codes, whose
+// meaning U2 does not document, the message is used, and an unrecognized
+// code in the server error range is a server error.
+func (e *U2Error) Unwrap() error {
+	switch e.Code {
+	case CodeParseError, CodeInvalidRequest, CodeMethodNotFound, CodeInvalidParams:
+		return ErrInvalidRequest
+	case CodeInternalError:
+		return ErrServer
+	}
+
+	message := strings.ToLower(e.Message)
+	switch {
+	case strings.Contains(message, "api key") || strings.Contains(message, "apikey") ||
+		strings.Contains(message, "unauthorized") || strings.Contains(message, "forbidden"):
+		return ErrInvalidAPIKey
+	case strings.Contains(message, "rate limit") || strings.Contains(message, "too many"):
+		return ErrRateLimited
+	case strings.Contains(message, "torrent not found") || strings.Contains(message, "no such torrent") ||
+		strings.Contains(message, "torrent deleted") || strings.Contains(message, "torrent does not exist"):
+		return ErrTorrentNotFound
+	case e.Code <= -32000 && e.Code >= -32099:
+		return ErrServer
+	}
+	return nil
+}
+
+// batchSizeError is an invalid request error about the size of a whole batch.
+type batchSizeError struct {
+	err *U2Error
+}
+
+func (e *batchSizeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *batchSizeError) Is(target error) bool {
+	return target == ErrBatchTooLarge
+}
+
+func (e *batchSizeError) Unwrap() error {
+	return e.err
+}
+
+// batchError returns the error U2 answered a whole batch with. U2 has no code
+// of its own for a batch that is too large, so an invalid request error that
+// mentions the batch is taken as one.
+func batchError(err *U2Error, size int) error {
+	if size > 1 && err.Code == CodeInvalidRequest && strings.Contains(strings.ToLower(err.Message), "batch") {
+		return &batchSizeError{err: err}
+	}
+	return err
+}
+
+// networkError is a request that did not get a complete response.
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string {
+	return e.err.Error()
+}
+
+func (e *networkError) Unwrap() error {
+	return e.err
+}
+
+// IsRetryable tells whether sending the same request again may succeed.
+func IsRetryable(err error) bool {
+	var netErr *networkError
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServer) || errors.As(err, &netErr)
+}
+
+// ShouldShrink tells whether a smaller batch may succeed where err failed: the
+// batch was too large, U2 was unavailable or failed, or the request timed out.
+// Plain rate limits are not fixed by smaller batches.
+func ShouldShrink(err error) bool {
+	var rateLimit *RateLimitError
+	if errors.As(err, &rateLimit) {
+		return rateLimit.StatusCode == http.StatusServiceUnavailable
+	}
+	var netErr *networkError
+	return errors.Is(err, ErrBatchTooLarge) || errors.Is(err, ErrServer) || errors.As(err, &netErr)
+}
@@ -0,0 +1,62 @@
+package u2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestU2ErrorUnwrap(t *testing.T) {
+	tests := []struct {
+		code    int
+		message string
+		want    error
+	}{
+		{CodeParseError, "parse error", ErrInvalidRequest},
+		{CodeInvalidRequest, "batch of 3 is larger than 2", ErrInvalidRequest},
+		{CodeMethodNotFound, "method not found", ErrInvalidRequest},
+		{CodeInvalidParams, "invalid params", ErrInvalidRequest},
+		{CodeInvalidParams, "torrent not found", ErrInvalidRequest},
+		{CodeMethodNotFound, "rate limit exceeded", ErrInvalidRequest},
+		{CodeInternalError, "internal error", ErrServer},
+		{CodeInternalError, "torrent not found", ErrServer},
+		{-32000, "server error", ErrServer},
+		{-32099, "", ErrServer},
+		{-32001, "Torrent not found", ErrTorrentNotFound},
+		{-32000, "Rate limit exceeded", ErrRateLimited},
+		{403, "Invalid API key", ErrInvalidAPIKey},
+		{1, "Torrent does not exist", ErrTorrentNotFound},
+		{1, "key not found", nil},
+		{1, "something else", nil},
+	}
+	sentinels := []error{ErrInvalidRequest, ErrServer, ErrTorrentNotFound, ErrRateLimited, ErrInvalidAPIKey}
+	for _, test := range tests {
+		err := &U2Error{Code: test.code, Message: test.message}
+		for _, sentinel := range sentinels {
+			if errors.Is(err, sentinel) != (sentinel == test.want) {
+				t.Errorf("errors.Is(%d %q, %v) = %v", test.code, test.message, sentinel, !(sentinel == test.want))
+			}
+		}
+	}
+}
+
+func TestShouldShrink(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&RateLimitError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&RateLimitError{StatusCode: http.StatusTooManyRequests}, false},
+		{&networkError{err: errors.New("timeout")}, true},
+		{fmt.Errorf("%w: 502 Bad Gateway", ErrServer), true},
+		{fmt.Errorf("%w: 413 Request Entity Too Large", ErrBatchTooLarge), true},
+		{ErrInvalidAPIKey, false},
+		{&U2Error{Code: CodeInvalidRequest, Message: "invalid request"}, false},
+	}
+	for _, test := range tests {
+		if got := ShouldShrink(test.err); got != test.want {
+			t.Errorf("ShouldShrink(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
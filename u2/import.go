@@ -0,0 +1,63 @@
+package u2
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Importer is implemented by drivers that can read connection settings from
+// the configuration files written by their client.
+type Importer interface {
+	ConfigPaths() []string
+
+	ImportConfig(path string) (*Config, error)
+}
+
+// ImportConfigs reads the client configuration files found at the default
+// locations of every registered driver.
+func ImportConfigs() []Config {
+	driversMu.RLock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	driversMu.RUnlock()
+	sort.Strings(names)
+
+	var found []Config
+	for _, name := range names {
+		importer, ok := getImporter(name)
+		if !ok {
+			continue
+		}
+		for _, path := range importer.ConfigPaths() {
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			config, err := importer.ImportConfig(path)
+			if err != nil {
+				fmt.Printf("Error while reading %s!\n", path)
+				fmt.Println(err)
+				continue
+			}
+			found = append(found, *config)
+		}
+	}
+	return found
+}
+
+func ImportConfig(target string, path string) (*Config, error) {
+	importer, ok := getImporter(target)
+	if !ok {
+		return nil, fmt.Errorf("u2: driver %q cannot import config files", target)
+	}
+	return importer.ImportConfig(path)
+}
+
+func getImporter(name string) (Importer, bool) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	importer, ok := drivers[name].(Importer)
+	return importer, ok
+}
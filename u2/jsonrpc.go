@@ -0,0 +1,114 @@
+package u2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const jsonRpcVersion = "2.0"
+
+// ErrNoResponse is the result of a request U2 left out of its batch response.
+var ErrNoResponse = errors.New("no response from U2")
+
+// KeyResult is the answer of U2 for one info hash.
+type KeyResult struct {
+	Key string
+	Err error
+}
+
+// batchCall sends requests as one JSON-RPC 2.0 batch and returns the responses
+// by request id. Responses with unknown or repeated ids are dropped, requests
+// without response are missing from the map. An error object instead of an
+// array fails the whole batch. A shrinkable batch is not retried at the same
+// size when a smaller one may succeed.
+func (c *Client) batchCall(requests []U2Request, shrinkable bool) (map[int]*U2Response, error) {
+	jsonRequestBytes, err := json.Marshal(requests)
+	if err != nil {
+		fmt.Println("Process u2 request failed!")
+		fmt.Println(err)
+		return nil, err
+	}
+	body, err := c.post(jsonRequestBytes, len(requests), shrinkable)
+	if err != nil {
+		return nil, err
+	}
+	return parseBatchResponse(requests, body)
+}
+
+func parseBatchResponse(requests []U2Request, body []byte) (map[int]*U2Response, error) {
+	body = bytes.TrimSpace(body)
+	var responses []*U2Response
+	if len(body) > 0 && body[0] == '{' {
+		var single U2Response
+		if err := json.Unmarshal(body, &single); err != nil {
+			fmt.Println("Error while processing u2 response!")
+			return nil, err
+		}
+		// A single reply to a batch is an error about the whole batch, such
+		// as a parse error, unless the batch had only this request.
+		if single.Id == nil || len(requests) != 1 {
+			if single.Error != nil {
+				return nil, batchError(single.Error, len(requests))
+			}
+			return nil, fmt.Errorf("unexpected single response to a batch of %d", len(requests))
+		}
+		responses = []*U2Response{&single}
+	} else if err := json.Unmarshal(body, &responses); err != nil {
+		fmt.Println("Error while processing u2 response!")
+		return nil, err
+	}
+
+	pending := make(map[int]bool, len(requests))
+	for _, request := range requests {
+		pending[request.Id] = true
+	}
+	result := make(map[int]*U2Response, len(requests))
+	for _, response := range responses {
+		if response == nil {
+			continue
+		}
+		if response.Id == nil {
+			if response.Error != nil && len(responses) == 1 {
+				return nil, batchError(response.Error, len(requests))
+			}
+			fmt.Println("Ignore u2 response without id!")
+			continue
+		}
+		if !pending[*response.Id] {
+			fmt.Printf("Ignore unexpected u2 response id %d!\n", *response.Id)
+			continue
+		}
+		delete(pending, *response.Id)
+		result[*response.Id] = response
+	}
+	if len(pending) > 0 {
+		fmt.Printf("U2 did not answer %d request(s)!\n", len(pending))
+	}
+	return result, nil
+}
+
+// keyResults maps the responses of the query requests to their info hash.
+func keyResults(requests []U2Request, responses map[int]*U2Response) map[string]KeyResult {
+	results := make(map[string]KeyResult, len(requests))
+	for _, request := range requests {
+		hash := request.Params[0]
+		response, ok := responses[request.Id]
+		if !ok {
+			results[hash] = KeyResult{Err: ErrNoResponse}
+			continue
+		}
+		if response.Error != nil {
+			results[hash] = KeyResult{Err: response.Error}
+			continue
+		}
+		var key string
+		if err := json.Unmarshal(response.Result, &key); err != nil || key == "" {
+			results[hash] = KeyResult{Err: fmt.Errorf("invalid result %s", string(response.Result))}
+			continue
+		}
+		results[hash] = KeyResult{Key: key}
+	}
+	return results
+}
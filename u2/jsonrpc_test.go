@@ -0,0 +1,163 @@
+package u2
+
+import (
+	"errors"
+	"testing"
+)
+
+func queryRequests(hashes ...string) []U2Request {
+	requests := make([]U2Request, 0, len(hashes))
+	for i, hash := range hashes {
+		requests = append(requests, U2Request{JsonRpc: jsonRpcVersion, Method: "query", Params: []string{hash}, Id: i + 1})
+	}
+	return requests
+}
+
+func TestParseBatchResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		hashes []string
+		body   string
+		keys   map[string]string
+		codes  map[string]int
+		noResp []string
+	}{
+		{
+			name:   "in order",
+			hashes: []string{"a", "b"},
+			body:   `[{"jsonrpc":"2.0","id":1,"result":"ka"},{"jsonrpc":"2.0","id":2,"result":"kb"}]`,
+			keys:   map[string]string{"a": "ka", "b": "kb"},
+		},
+		{
+			name:   "shuffled",
+			hashes: []string{"a", "b", "c"},
+			body:   `[{"jsonrpc":"2.0","id":3,"result":"kc"},{"jsonrpc":"2.0","id":1,"result":"ka"},{"jsonrpc":"2.0","id":2,"result":"kb"}]`,
+			keys:   map[string]string{"a": "ka", "b": "kb", "c": "kc"},
+		},
+		{
+			name:   "per request error",
+			hashes: []string{"a", "b"},
+			body:   `[{"jsonrpc":"2.0","id":1,"result":"ka"},{"jsonrpc":"2.0","id":2,"error":{"code":-32602,"message":"invalid params"}}]`,
+			keys:   map[string]string{"a": "ka"},
+			codes:  map[string]int{"b": CodeInvalidParams},
+		},
+		{
+			name:   "dropped",
+			hashes: []string{"a", "b", "c"},
+			body:   `[{"jsonrpc":"2.0","id":2,"result":"kb"}]`,
+			keys:   map[string]string{"b": "kb"},
+			noResp: []string{"a", "c"},
+		},
+		{
+			name:   "extra and repeated ids",
+			hashes: []string{"a", "b"},
+			body:   `[{"jsonrpc":"2.0","id":1,"result":"ka"},{"jsonrpc":"2.0","id":1,"result":"other"},{"jsonrpc":"2.0","id":9,"result":"k9"},{"jsonrpc":"2.0","id":null,"result":"none"},null]`,
+			keys:   map[string]string{"a": "ka"},
+			noResp: []string{"b"},
+		},
+		{
+			name:   "empty array",
+			hashes: []string{"a"},
+			body:   `[]`,
+			noResp: []string{"a"},
+		},
+		{
+			name:   "single object for a single request",
+			hashes: []string{"a"},
+			body:   ` {"jsonrpc":"2.0","id":1,"result":"ka"}` + "\n",
+			keys:   map[string]string{"a": "ka"},
+		},
+		{
+			name:   "single object error for a single request",
+			hashes: []string{"a"},
+			body:   `{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"torrent not found"}}`,
+			codes:  map[string]int{"a": -32001},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := queryRequests(test.hashes...)
+			responses, err := parseBatchResponse(requests, []byte(test.body))
+			if err != nil {
+				t.Fatalf("parseBatchResponse: %v", err)
+			}
+			results := keyResults(requests, responses)
+			if len(results) != len(test.hashes) {
+				t.Errorf("got %d results, want %d", len(results), len(test.hashes))
+			}
+			for hash, key := range test.keys {
+				if result := results[hash]; result.Err != nil || result.Key != key {
+					t.Errorf("result of %s = %+v, want key %s", hash, result, key)
+				}
+			}
+			for hash, code := range test.codes {
+				var u2Err *U2Error
+				if result := results[hash]; !errors.As(result.Err, &u2Err) || u2Err.Code != code {
+					t.Errorf("result of %s = %+v, want error code %d", hash, result, code)
+				}
+			}
+			for _, hash := range test.noResp {
+				if result := results[hash]; !errors.Is(result.Err, ErrNoResponse) {
+					t.Errorf("result of %s = %+v, want ErrNoResponse", hash, result)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBatchResponseInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		hashes []string
+		body   string
+		code   int
+	}{
+		{"single object error without id", []string{"a", "b"}, `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`, CodeParseError},
+		{"single object error with id for a batch", []string{"a", "b"}, `{"jsonrpc":"2.0","id":1,"error":{"code":-32600,"message":"invalid request"}}`, CodeInvalidRequest},
+		{"array with only an error without id", []string{"a", "b"}, `[{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}]`, CodeInvalidRequest},
+		{"single object result for a batch", []string{"a", "b"}, `{"jsonrpc":"2.0","id":1,"result":"ka"}`, 0},
+		{"not json", []string{"a"}, `<html>bad gateway</html>`, 0},
+		{"truncated", []string{"a", "b"}, `[{"jsonrpc":"2.0","id":1,"result":"ka"},{"jsonrpc"`, 0},
+		{"empty", []string{"a"}, ``, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses, err := parseBatchResponse(queryRequests(test.hashes...), []byte(test.body))
+			if err == nil {
+				t.Fatalf("parseBatchResponse = %v, want an error", responses)
+			}
+			var u2Err *U2Error
+			if test.code != 0 && (!errors.As(err, &u2Err) || u2Err.Code != test.code) {
+				t.Errorf("parseBatchResponse error = %v, want code %d", err, test.code)
+			}
+		})
+	}
+}
+
+func TestKeyResultsInvalidResult(t *testing.T) {
+	requests := queryRequests("a", "b")
+	responses, err := parseBatchResponse(requests, []byte(`[{"jsonrpc":"2.0","id":1,"result":""},{"jsonrpc":"2.0","id":2,"result":42}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hash, result := range keyResults(requests, responses) {
+		if result.Err == nil || errors.Is(result.Err, ErrNoResponse) {
+			t.Errorf("result of %s = %+v, want an invalid result error", hash, result)
+		}
+	}
+}
+
+func TestParseBatchResponseTooLarge(t *testing.T) {
+	body := []byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batch of 3 is larger than 2"}}`)
+	_, err := parseBatchResponse(queryRequests("a", "b", "c"), body)
+	var u2Err *U2Error
+	if !errors.Is(err, ErrBatchTooLarge) || !errors.As(err, &u2Err) || !ShouldShrink(err) || IsRetryable(err) {
+		t.Errorf("parseBatchResponse error = %v, want ErrBatchTooLarge", err)
+	}
+	if _, err := parseBatchResponse(queryRequests("a", "b"), []byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}`)); errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("parseBatchResponse error = %v, want no ErrBatchTooLarge", err)
+	}
+	if _, err := parseBatchResponse(queryRequests("a"), body); errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("parseBatchResponse error of a single request = %v, want no ErrBatchTooLarge", err)
+	}
+}
@@ -0,0 +1,136 @@
+package u2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const DefaultCacheFile = "keys.json"
+
+// CacheConfig keeps the keys fetched from U2 in File for TTL, so that a torrent
+// queried again soon, e.g. after a failed run or from another client, does not
+// cost another query. The cache is off unless TTL is positive. Keys cached
+// with another API key are never used.
+type CacheConfig struct {
+	TTL  Duration
+	File string
+}
+
+func (c *CacheConfig) Validate() error {
+	if c.File != "" && strings.TrimSpace(c.File) == "" {
+		return fmt.Errorf("cache file must not be blank")
+	}
+	return nil
+}
+
+type CachedKey struct {
+	Key     string
+	Fetched time.Time
+}
+
+// cacheFile is the content of the cache file. It keeps the keys of every API
+// key in their own section, named by a hash of the API key. Account and Keys
+// are the single section of older cache files.
+type cacheFile struct {
+	Accounts map[string]map[string]CachedKey
+	Account  string               `json:",omitempty"`
+	Keys     map[string]CachedKey `json:",omitempty"`
+}
+
+// KeyCache maps info hashes to the keys fetched from U2 with one API key.
+type KeyCache struct {
+	ttl      time.Duration
+	path     string
+	account  string
+	keys     map[string]CachedKey
+	accounts map[string]map[string]CachedKey
+	readOnly bool
+}
+
+// NewKeyCache reads the cache of apiKey. The keys of other API keys are kept
+// in the file but never used. A cache file that cannot be read is left as it
+// is and not updated.
+func NewKeyCache(config CacheConfig, apiKey string) *KeyCache {
+	sum := sha256.Sum256([]byte(apiKey))
+	cache := &KeyCache{
+		ttl:      time.Duration(config.TTL),
+		path:     config.File,
+		account:  hex.EncodeToString(sum[:8]),
+		keys:     make(map[string]CachedKey),
+		accounts: make(map[string]map[string]CachedKey),
+	}
+	if cache.path == "" {
+		cache.path = DefaultCacheFile
+	}
+	if !cache.Enabled() {
+		return cache
+	}
+	data, err := ioutil.ReadFile(cache.path)
+	if err != nil {
+		return cache
+	}
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil || (file.Accounts == nil && file.Account == "") {
+		fmt.Printf("Key cache %s cannot be read, it is left untouched and fetched keys are not saved.\n", cache.path)
+		cache.readOnly = true
+		return cache
+	}
+	if file.Accounts != nil {
+		cache.accounts = file.Accounts
+	}
+	if file.Account != "" && cache.accounts[file.Account] == nil {
+		cache.accounts[file.Account] = file.Keys
+	}
+	if keys := cache.accounts[cache.account]; keys != nil {
+		cache.keys = keys
+	}
+	return cache
+}
+
+func (c *KeyCache) Enabled() bool {
+	return c.ttl > 0
+}
+
+// Get returns the key of hash when it was fetched within the TTL.
+func (c *KeyCache) Get(hash string) (string, bool) {
+	if !c.Enabled() {
+		return "", false
+	}
+	cached, ok := c.keys[strings.ToLower(hash)]
+	if !ok || time.Since(cached.Fetched) > c.ttl {
+		return "", false
+	}
+	return cached.Key, true
+}
+
+func (c *KeyCache) Put(hash string, key string) {
+	if c.Enabled() {
+		c.keys[strings.ToLower(hash)] = CachedKey{Key: key, Fetched: time.Now()}
+	}
+}
+
+// Save writes the cache without the expired keys of this API key.
+func (c *KeyCache) Save() {
+	if !c.Enabled() || c.readOnly {
+		return
+	}
+	for hash, cached := range c.keys {
+		if time.Since(cached.Fetched) > c.ttl {
+			delete(c.keys, hash)
+		}
+	}
+	c.accounts[c.account] = c.keys
+	data, err := json.Marshal(cacheFile{Accounts: c.accounts})
+	if err == nil {
+		err = ioutil.WriteFile(c.path, data, os.FileMode(0600))
+	}
+	if err != nil {
+		fmt.Printf("Saving key cache to %s failed: %v\n", c.path, err)
+	}
+}
@@ -0,0 +1,119 @@
+package u2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testCacheConfig(t *testing.T, ttl time.Duration) CacheConfig {
+	dir, err := ioutil.TempDir("", "keycache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return CacheConfig{TTL: Duration(ttl), File: filepath.Join(dir, "keys.json")}
+}
+
+func TestKeyCacheOffByDefault(t *testing.T) {
+	config := testCacheConfig(t, 0)
+	cache := NewKeyCache(config, "key1")
+	cache.Put("AAAA", "secret")
+	cache.Save()
+	if cache.Enabled() {
+		t.Error("cache without TTL is enabled")
+	}
+	if _, ok := cache.Get("aaaa"); ok {
+		t.Error("disabled cache returned a key")
+	}
+	if _, err := os.Stat(config.File); !os.IsNotExist(err) {
+		t.Errorf("disabled cache wrote %s", config.File)
+	}
+}
+
+func TestKeyCacheApiKey(t *testing.T) {
+	config := testCacheConfig(t, time.Hour)
+	cache := NewKeyCache(config, "key1")
+	cache.Put("AAAA", "secret")
+	cache.Save()
+
+	if key, ok := NewKeyCache(config, "key1").Get("aaaa"); !ok || key != "secret" {
+		t.Errorf("Get with the same API key = %q, %v, want secret", key, ok)
+	}
+	other := NewKeyCache(config, "key2")
+	if key, ok := other.Get("aaaa"); ok {
+		t.Errorf("Get with another API key = %q, want no key", key)
+	}
+	other.Put("aaaa", "other")
+	other.Save()
+
+	// Both API keys keep their own keys in the same file.
+	if key, ok := NewKeyCache(config, "key1").Get("aaaa"); !ok || key != "secret" {
+		t.Errorf("Get after another API key saved = %q, %v, want secret", key, ok)
+	}
+	if key, ok := NewKeyCache(config, "key2").Get("aaaa"); !ok || key != "other" {
+		t.Errorf("Get with the other API key = %q, %v, want other", key, ok)
+	}
+}
+
+func TestKeyCacheSingleAccountFile(t *testing.T) {
+	config := testCacheConfig(t, time.Hour)
+	fetched := time.Now().Format(time.RFC3339)
+	file := `{"Account":"` + NewKeyCache(config, "key1").account + `","Keys":{"aaaa":{"Key":"secret","Fetched":"` + fetched + `"}}}`
+	if err := ioutil.WriteFile(config.File, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewKeyCache(config, "key2")
+	cache.Put("bbbb", "other")
+	cache.Save()
+	if key, ok := NewKeyCache(config, "key1").Get("aaaa"); !ok || key != "secret" {
+		t.Errorf("Get from a single account file = %q, %v, want secret", key, ok)
+	}
+}
+
+func TestKeyCacheUnreadableFile(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"not json", `{"Accounts":`},
+		{"without API key", `{"aaaa":{"Key":"secret","Fetched":"` + time.Now().Format(time.RFC3339) + `"}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testCacheConfig(t, time.Hour)
+			if err := ioutil.WriteFile(config.File, []byte(test.file), 0600); err != nil {
+				t.Fatal(err)
+			}
+			cache := NewKeyCache(config, "key1")
+			if key, ok := cache.Get("aaaa"); ok {
+				t.Errorf("Get from an unreadable cache file = %q, want no key", key)
+			}
+			cache.Put("bbbb", "new")
+			cache.Save()
+			if data, err := ioutil.ReadFile(config.File); err != nil || string(data) != test.file {
+				t.Errorf("cache file = %q, %v, want it untouched", data, err)
+			}
+		})
+	}
+}
+
+func TestKeyCacheTTL(t *testing.T) {
+	config := testCacheConfig(t, time.Hour)
+	cache := NewKeyCache(config, "key1")
+	cache.keys["aaaa"] = CachedKey{Key: "old", Fetched: time.Now().Add(-2 * time.Hour)}
+	cache.Put("bbbb", "new")
+	if _, ok := cache.Get("aaaa"); ok {
+		t.Error("expired key was returned")
+	}
+	cache.Save()
+	cache = NewKeyCache(config, "key1")
+	if _, ok := cache.keys["aaaa"]; ok {
+		t.Error("expired key was saved")
+	}
+	if key, ok := cache.Get("BBBB"); !ok || key != "new" {
+		t.Errorf("Get = %q, %v, want new", key, ok)
+	}
+}
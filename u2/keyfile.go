@@ -0,0 +1,145 @@
+package u2
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExportedKey is one entry of a key file.
+type ExportedKey struct {
+	Hash string
+	Name string
+	Key  string
+}
+
+// ReadKeyFile reads hash to key pairs from a JSON or CSV file. JSON is either
+// an object of hash to key or a list of objects with Hash and Key. CSV has the
+// hash and the key in the first two columns, or in the columns named hash and
+// key by a header row. A key may also be a whole announce URL.
+func ReadKeyFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pairs [][2]string
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		pairs, err = parseJsonKeys(data)
+	} else {
+		pairs, err = parseCsvKeys(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %v", path, err)
+	}
+
+	keys := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		hash := strings.ToLower(strings.TrimSpace(pair[0]))
+		key := ParseSecure(strings.TrimSpace(pair[1]))
+		if hash == "" || key == "" {
+			return nil, fmt.Errorf("invalid key file %s: missing hash or key for %q", path, pair[0])
+		}
+		keys[hash] = key
+	}
+	return keys, nil
+}
+
+func parseJsonKeys(data []byte) ([][2]string, error) {
+	var pairs [][2]string
+	var object map[string]string
+	if err := json.Unmarshal(data, &object); err == nil {
+		for hash, key := range object {
+			pairs = append(pairs, [2]string{hash, key})
+		}
+		return pairs, nil
+	}
+	var list []struct {
+		Hash string
+		Key  string
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, item := range list {
+		pairs = append(pairs, [2]string{item.Hash, item.Key})
+	}
+	return pairs, nil
+}
+
+func parseCsvKeys(data []byte) ([][2]string, error) {
+	reader := csv.NewReader(strings.NewReader(string(data)))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	hashColumn, keyColumn := 0, 1
+	if len(rows) > 0 {
+		header := false
+		for i, name := range rows[0] {
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "hash", "info_hash", "infohash":
+				hashColumn, header = i, true
+			case "key", "secure":
+				keyColumn, header = i, true
+			}
+		}
+		if header {
+			rows = rows[1:]
+		}
+	}
+
+	var pairs [][2]string
+	for _, row := range rows {
+		if len(row) <= hashColumn || len(row) <= keyColumn {
+			return nil, fmt.Errorf("row %q has too few columns", strings.Join(row, ","))
+		}
+		pairs = append(pairs, [2]string{row[hashColumn], row[keyColumn]})
+	}
+	return pairs, nil
+}
+
+// ParseSecure returns the secure key of an announce URL, or value itself when
+// it is not an announce URL.
+func ParseSecure(value string) string {
+	if !strings.Contains(value, "://") {
+		return value
+	}
+	announceUrl, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	return announceUrl.Query().Get("secure")
+}
+
+// WriteKeyFile writes keys as CSV with a hash, name and key header, or as a
+// JSON list when path ends with .json.
+func WriteKeyFile(path string, keys []ExportedKey) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var err error
+		if data, err = json.MarshalIndent(keys, "", "  "); err != nil {
+			return err
+		}
+	} else {
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		_ = writer.Write([]string{"hash", "name", "key"})
+		for _, key := range keys {
+			_ = writer.Write([]string{key.Hash, key.Name, key.Key})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		data = buffer.Bytes()
+	}
+	return ioutil.WriteFile(path, data, os.FileMode(0600))
+}
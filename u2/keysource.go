@@ -0,0 +1,70 @@
+package u2
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrNoKey is the KeyResult error of a hash an offline source has no key for.
+var ErrNoKey = errors.New("no key for torrent")
+
+// KeySource gives the secure keys of info hashes. Each hash gets a KeyResult,
+// the error is only for failures of the whole lookup.
+type KeySource interface {
+	GetNewKey(hashes []string) (map[string]KeyResult, error)
+}
+
+// Client is the live source asking the U2 JSON-RPC API.
+var _ KeySource = (*Client)(nil)
+
+// NewU2KeySource returns a live source asking the U2 API of config. It has no
+// torrent client, its torrent client methods fail with ErrNoDriver.
+func NewU2KeySource(config *Config) (*Client, error) {
+	return newClient(config, nil)
+}
+
+// StaticKeySource serves the keys of a file, e.g. one exported from the site.
+type StaticKeySource struct {
+	keys map[string]string
+}
+
+func NewStaticKeySource(path string) (*StaticKeySource, error) {
+	keys, err := ReadKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticKeySource{keys: keys}, nil
+}
+
+func (s *StaticKeySource) GetNewKey(hashes []string) (map[string]KeyResult, error) {
+	results := make(map[string]KeyResult, len(hashes))
+	for _, hash := range hashes {
+		if key, ok := s.keys[strings.ToLower(hash)]; ok {
+			results[hash] = KeyResult{Key: key}
+		} else {
+			results[hash] = KeyResult{Err: ErrNoKey}
+		}
+	}
+	return results, nil
+}
+
+// CacheKeySource serves the keys of a KeyCache without going online.
+type CacheKeySource struct {
+	cache *KeyCache
+}
+
+func NewCacheKeySource(cache *KeyCache) *CacheKeySource {
+	return &CacheKeySource{cache: cache}
+}
+
+func (s *CacheKeySource) GetNewKey(hashes []string) (map[string]KeyResult, error) {
+	results := make(map[string]KeyResult, len(hashes))
+	for _, hash := range hashes {
+		if key, ok := s.cache.Get(hash); ok {
+			results[hash] = KeyResult{Key: key}
+		} else {
+			results[hash] = KeyResult{Err: ErrNoKey}
+		}
+	}
+	return results, nil
+}
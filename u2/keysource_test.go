@@ -0,0 +1,40 @@
+package u2_test
+
+import (
+	"errors"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"github.com/i0range/U2KeyResetTool/u2test"
+	"testing"
+)
+
+func TestU2KeySourceWithoutDriver(t *testing.T) {
+	server := u2test.NewServer(u2test.Config{ApiKey: testApiKey})
+	defer server.Close()
+	source, err := u2.NewU2KeySource(testConfig(t, server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	if ok, err := source.Check(); ok || !errors.Is(err, u2.ErrNoDriver) {
+		t.Errorf("Check = %v, %v, want ErrNoDriver", ok, err)
+	}
+	if torrents := source.GetTorrentList(nil); len(*torrents) != 0 {
+		t.Errorf("GetTorrentList = %v, want no torrents", *torrents)
+	}
+	if torrents := source.GetUntrackedTorrents(nil); len(*torrents) != 0 {
+		t.Errorf("GetUntrackedTorrents = %v, want no torrents", *torrents)
+	}
+	if source.EditTorrentTracker(&u2.Torrent{Hash: "aaaa"}, "https://example.com/announce") {
+		t.Error("EditTorrentTracker succeeded without a torrent client")
+	}
+
+	var keySource u2.KeySource = source
+	results, err := keySource.GetNewKey([]string{"aaaa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := results["aaaa"]; result.Err != nil || result.Key != u2test.Key("aaaa") {
+		t.Errorf("GetNewKey = %+v, want %s", result, u2test.Key("aaaa"))
+	}
+}
@@ -0,0 +1,94 @@
+package u2
+
+import (
+	"regexp"
+	"strings"
+)
+
+// defaultMetadataPattern recognises the comment and source U2 writes into its
+// torrents when no rule is configured.
+const defaultMetadataPattern = "dmhy"
+
+// MetadataRules recognise U2 torrents that lost their U2 tracker. Comment,
+// Source and CreatedBy are regular expressions, Hashes are info hashes that
+// always count as U2.
+type MetadataRules struct {
+	Comment   []string
+	Source    []string
+	CreatedBy []string
+	Hashes    []string
+}
+
+func (r *MetadataRules) Validate() error {
+	_, err := NewMetadataMatcher(*r)
+	return err
+}
+
+// TorrentMeta is a torrent without a matching tracker. Torrent.Tracker is
+// empty, so EditTorrentTracker adds the U2 tracker instead of replacing one.
+type TorrentMeta struct {
+	Torrent   Torrent
+	Comment   string
+	Source    string
+	CreatedBy string
+}
+
+type MetadataMatcher struct {
+	comment   []*regexp.Regexp
+	source    []*regexp.Regexp
+	createdBy []*regexp.Regexp
+	hashes    map[string]bool
+}
+
+func NewMetadataMatcher(rules MetadataRules) (*MetadataMatcher, error) {
+	matcher := &MetadataMatcher{hashes: make(map[string]bool)}
+	for _, hash := range rules.Hashes {
+		if hash = strings.ToLower(strings.TrimSpace(hash)); hash != "" {
+			matcher.hashes[hash] = true
+		}
+	}
+
+	comment, source := rules.Comment, rules.Source
+	if len(comment) == 0 && len(source) == 0 && len(rules.CreatedBy) == 0 {
+		comment = []string{defaultMetadataPattern}
+		source = []string{defaultMetadataPattern}
+	}
+	var err error
+	if matcher.comment, err = compilePatterns(comment); err != nil {
+		return nil, err
+	}
+	if matcher.source, err = compilePatterns(source); err != nil {
+		return nil, err
+	}
+	if matcher.createdBy, err = compilePatterns(rules.CreatedBy); err != nil {
+		return nil, err
+	}
+	return matcher, nil
+}
+
+func matchPatterns(patterns []*regexp.Regexp, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, re := range patterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the reason meta is considered a U2 torrent, or false.
+func (m *MetadataMatcher) Match(meta *TorrentMeta) (string, bool) {
+	switch {
+	case m.hashes[strings.ToLower(meta.Torrent.Hash)]:
+		return "hash list", true
+	case matchPatterns(m.comment, meta.Comment):
+		return "comment", true
+	case matchPatterns(m.source, meta.Source):
+		return "source", true
+	case matchPatterns(m.createdBy, meta.CreatedBy):
+		return "created by", true
+	}
+	return "", false
+}
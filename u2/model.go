@@ -1,59 +1,102 @@
 package u2
 
-import "strings"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
+// Torrent is a torrent with a U2 tracker. Tracker is empty for torrents that
+// lost it, EditTorrentTracker then adds the new tracker.
 type Torrent struct {
 	Hash    string
+	Tracker string
 	ExtInfo interface{}
+
+	// TrackerMessage is the last announce result of Tracker reported by the
+	// client, TrackerFailed is set when that announce failed.
+	TrackerMessage string
+	TrackerFailed  bool
+
+	// Details reported by the client, left empty when it has none of them.
+	// State is one of the State constants.
+	Name      string
+	Category  string
+	Tags      []string
+	State     string
+	SavePath  string
+	Size      int64
+	AddedTime time.Time
+
+	// Uploaded is the total uploaded bytes, UploadRate the current upload
+	// speed in bytes per second.
+	Uploaded   int64
+	UploadRate int64
 }
 
+const (
+	StateDownloading = "downloading"
+	StateSeeding     = "seeding"
+	StatePaused      = "paused"
+	StateChecking    = "checking"
+	StateQueued      = "queued"
+	StateError       = "error"
+	StateUnknown     = "unknown"
+)
+
+var States = []string{StateDownloading, StateSeeding, StatePaused, StateChecking, StateQueued, StateError, StateUnknown}
+
 type U2Request struct {
 	JsonRpc string   `json:"jsonrpc"`
 	Method  string   `json:"method"`
 	Params  []string `json:"params"`
 	Id      int      `json:"id"`
+	ApiKey  string   `json:"apikey,omitempty"`
 }
 
 type U2Error struct {
-	Code    int    `json:"code,omitempty"`
-	Message string `json:"message,omitempty"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *U2Error) Error() string {
+	return fmt.Sprintf("u2 error %d: %s", e.Code, e.Message)
 }
 
+// U2Response is one response of a batch. Id is nil when U2 could not read the
+// request id, and exactly one of Result and Error is set.
 type U2Response struct {
-	Id     int     `json:"id,omitempty"`
-	Result string  `json:"result,omitempty"`
-	Error  U2Error `json:"error,omitempty"`
+	JsonRpc string          `json:"jsonrpc"`
+	Id      *int            `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *U2Error        `json:"error,omitempty"`
 }
 
+// Config is saved to config.json. BasePath is the path the client is served
+// under, the WebUI root of qBittorrent or the rpc-url of Transmission.
 type Config struct {
-	Target string
-	Host   string
-	Port   uint16
-	Secure bool
-	User   string
-	Pass   string
-	ApiKey string
-	Proxy  string
-}
+	Target      string
+	Host        string
+	Port        uint16
+	Secure      bool
+	BasePath    string
+	User        string
+	Pass        string
+	ApiKey      string
+	ApiUrl      string
+	ApiKeyIn    string
+	Proxy       string
+	ClientProxy string
+	TLS         TLSConfig
+	ApiTLS      TLSConfig
 
-func (c *Config) Validate() bool {
-	if c.Target == "" {
-		c.Target = "transmission"
-	}
-	if c.Host == "" {
-		return false
-	}
-	if c.Port == 0 {
-		return false
-	}
-	if c.ApiKey == "" {
-		return false
-	}
-	c.ApiKey = strings.ReplaceAll(c.ApiKey, "https://", "")
-	c.ApiKey = strings.ReplaceAll(c.ApiKey, "u2.dmhy.org", "")
-	c.ApiKey = strings.ReplaceAll(c.ApiKey, "/", "")
-	c.ApiKey = strings.ReplaceAll(c.ApiKey, "jsonrpc_torrentkey.php", "")
-	c.ApiKey = strings.ReplaceAll(c.ApiKey, "apikey=", "")
-	c.ApiKey = strings.ReplaceAll(c.ApiKey, "?", "")
-	return true
+	TrackerRules TrackerRules
+	Metadata     MetadataRules
+	Announce     AnnounceConfig
+	RateLimit    RateLimitConfig
+	Retry        RetryConfig
+	Batch        BatchConfig
+	Budget       BudgetConfig
+	Cache        CacheConfig
 }
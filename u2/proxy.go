@@ -0,0 +1,63 @@
+package u2
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ProxyDirect disables proxies, including the ones from HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY.
+const ProxyDirect = "direct"
+
+// ProxyFunc resolves a proxy setting. An empty setting follows the standard
+// proxy environment variables. http, https, socks5 and socks5h URLs are
+// supported, with credentials in the user info part.
+func ProxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case ProxyDirect:
+		return nil, nil
+	}
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch proxyUrl.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyUrl.Scheme)
+	}
+	if proxyUrl.Host == "" {
+		return nil, fmt.Errorf("proxy %q has no host", proxy)
+	}
+	return http.ProxyURL(proxyUrl), nil
+}
+
+// NewHTTPClient returns an http.Client using the given TLS and proxy settings.
+func NewHTTPClient(tlsConfig *TLSConfig, proxy string, timeout time.Duration) (*http.Client, error) {
+	builtTLS, err := tlsConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+	proxyFunc, err := ProxyFunc(proxy)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = builtTLS
+	transport.Proxy = proxyFunc
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// ApiHTTPClient returns the http.Client for requests to the U2 API.
+func (c *Config) ApiHTTPClient(timeout time.Duration) (*http.Client, error) {
+	return NewHTTPClient(&c.ApiTLS, c.Proxy, timeout)
+}
+
+// ClientHTTPClient returns the http.Client for requests to the torrent client.
+func (c *Config) ClientHTTPClient(timeout time.Duration) (*http.Client, error) {
+	return NewHTTPClient(&c.TLS, c.ClientProxy, timeout)
+}
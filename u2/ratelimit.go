@@ -0,0 +1,108 @@
+package u2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	DefaultRequestsPerMinute = 12
+	DefaultBurst             = 1
+	DefaultLimiterStateFile  = "ratelimit.json"
+)
+
+// RateLimitConfig spaces out U2 API requests with a token bucket. The bucket
+// is saved to StateFile so that runs started right after each other share it.
+type RateLimitConfig struct {
+	RequestsPerMinute float64
+	Burst             int
+	StateFile         string
+}
+
+func (r *RateLimitConfig) Validate() error {
+	if r.RequestsPerMinute < 0 {
+		return fmt.Errorf("requests per minute must not be negative")
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	return nil
+}
+
+type limiterState struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// TokenBucket allows Burst requests at once and refills at the configured
+// rate.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+	path  string
+	state limiterState
+}
+
+func NewTokenBucket(config RateLimitConfig) *TokenBucket {
+	bucket := &TokenBucket{
+		rate:  config.RequestsPerMinute / 60,
+		burst: float64(config.Burst),
+		path:  config.StateFile,
+	}
+	if bucket.rate == 0 {
+		bucket.rate = float64(DefaultRequestsPerMinute) / 60
+	}
+	if bucket.burst == 0 {
+		bucket.burst = DefaultBurst
+	}
+	if bucket.path == "" {
+		bucket.path = DefaultLimiterStateFile
+	}
+	bucket.state = limiterState{Tokens: bucket.burst, Updated: time.Now()}
+	if data, err := ioutil.ReadFile(bucket.path); err == nil {
+		var saved limiterState
+		if json.Unmarshal(data, &saved) == nil && !saved.Updated.IsZero() {
+			bucket.state = saved
+		}
+	}
+	return bucket
+}
+
+// Wait blocks until a request is allowed and takes its token.
+func (b *TokenBucket) Wait() {
+	b.refill(time.Now())
+	if b.state.Tokens < 1 {
+		wait := time.Duration((1 - b.state.Tokens) / b.rate * float64(time.Second))
+		if wait >= time.Second {
+			fmt.Printf("Waiting %s for the U2 request rate limit.\n", wait.Round(time.Second))
+		}
+		time.Sleep(wait)
+		b.refill(time.Now())
+	}
+	b.state.Tokens--
+	b.save()
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.state.Updated).Seconds()
+	if elapsed > 0 {
+		b.state.Tokens += elapsed * b.rate
+	}
+	if b.state.Tokens > b.burst {
+		b.state.Tokens = b.burst
+	}
+	b.state.Updated = now
+}
+
+func (b *TokenBucket) save() {
+	data, err := json.Marshal(b.state)
+	if err == nil {
+		err = ioutil.WriteFile(b.path, data, os.FileMode(0644))
+	}
+	if err != nil {
+		fmt.Printf("Saving rate limit state to %s failed: %v\n", b.path, err)
+	}
+}
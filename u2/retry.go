@@ -0,0 +1,92 @@
+package u2
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxRetries  = 5
+	DefaultInitialWait = 5 * time.Second
+	DefaultMaxWait     = 5 * time.Minute
+)
+
+// RetryConfig controls how failed U2 API requests are retried. Zero values
+// fall back to the defaults, a negative MaxRetries disables retries.
+type RetryConfig struct {
+	MaxRetries  int
+	InitialWait Duration
+	MaxWait     Duration
+}
+
+func (r *RetryConfig) Validate() error {
+	if r.InitialWait < 0 || r.MaxWait < 0 {
+		return fmt.Errorf("wait times must not be negative")
+	}
+	if r.MaxWait != 0 && r.MaxWait < r.InitialWait {
+		return fmt.Errorf("maximum wait %s is shorter than initial wait %s", time.Duration(r.MaxWait), time.Duration(r.InitialWait))
+	}
+	return nil
+}
+
+func (r *RetryConfig) maxRetries() int {
+	if r.MaxRetries == 0 {
+		return DefaultMaxRetries
+	}
+	if r.MaxRetries < 0 {
+		return 0
+	}
+	return r.MaxRetries
+}
+
+// backoff returns the wait before retry number attempt, counted from 0. The
+// wait doubles with every attempt up to MaxWait and a random part of up to
+// half of it spreads out clients failing at the same time. A retryAfter sent
+// by the server is honored as is.
+func (r *RetryConfig) backoff(attempt int, retryAfter time.Duration, random *rand.Rand) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	initialWait, maxWait := time.Duration(r.InitialWait), time.Duration(r.MaxWait)
+	if initialWait == 0 {
+		initialWait = DefaultInitialWait
+	}
+	if maxWait == 0 {
+		maxWait = DefaultMaxWait
+	}
+	wait := initialWait
+	for i := 0; i < attempt && wait < maxWait; i++ {
+		wait *= 2
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+	half := int64(wait / 2)
+	if half <= 0 {
+		return wait
+	}
+	return time.Duration(half + random.Int63n(half+1))
+}
+
+// ParseRetryAfter reads a Retry-After header in seconds or as an HTTP date,
+// zero when it is missing or invalid.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
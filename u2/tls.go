@@ -0,0 +1,123 @@
+package u2
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+type TLSConfig struct {
+	CaFile      string
+	Fingerprint string
+	Insecure    bool
+	CertFile    string
+	KeyFile     string
+}
+
+func (t *TLSConfig) IsZero() bool {
+	return *t == TLSConfig{}
+}
+
+// HasVerification reports whether the server certificate is checked against
+// something the user provided rather than the system roots.
+func (t *TLSConfig) HasVerification() bool {
+	return t.CaFile != "" || t.Fingerprint != ""
+}
+
+func (t *TLSConfig) Normalize() {
+	t.Fingerprint = NormalizeFingerprint(t.Fingerprint)
+}
+
+func (t *TLSConfig) Validate() error {
+	if t.CaFile != "" {
+		if _, err := os.Stat(t.CaFile); err != nil {
+			return fmt.Errorf("cannot read CA file: %v", err)
+		}
+	}
+	if t.Fingerprint != "" {
+		if fingerprint, err := hex.DecodeString(t.Fingerprint); err != nil || len(fingerprint) != sha256.Size {
+			return fmt.Errorf("fingerprint %q is not a SHA-256 hex string", t.Fingerprint)
+		}
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("client certificate and key must be set together")
+	}
+	return nil
+}
+
+// Build creates the tls.Config for a connection. A pinned fingerprint replaces
+// chain verification, so self-signed certificates can be trusted one by one.
+func (t *TLSConfig) Build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: t.Insecure}
+
+	if t.CaFile != "" {
+		caBytes, err := ioutil.ReadFile(t.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificate found in %s", t.CaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if t.Fingerprint != "" {
+		pinned := NormalizeFingerprint(t.Fingerprint)
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("server sent no certificate")
+			}
+			if actual := CertFingerprint(rawCerts[0]); actual != pinned {
+				return fmt.Errorf("certificate fingerprint %s does not match pinned %s", actual, pinned)
+			}
+			return nil
+		}
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func CertFingerprint(rawCert []byte) string {
+	sum := sha256.Sum256(rawCert)
+	return hex.EncodeToString(sum[:])
+}
+
+func NormalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ToLower(strings.TrimSpace(fingerprint))
+	fingerprint = strings.TrimPrefix(fingerprint, "sha256:")
+	return strings.NewReplacer(":", "", " ", "").Replace(fingerprint)
+}
+
+// FetchFingerprint connects to address without verification and returns the
+// fingerprint of the certificate presented, so the user can decide to pin it.
+func FetchFingerprint(address string, timeout time.Duration) (string, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", address, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", fmt.Errorf("server sent no certificate")
+	}
+	return CertFingerprint(certs[0].Raw), nil
+}
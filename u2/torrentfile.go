@@ -0,0 +1,105 @@
+package u2
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+)
+
+// ReadTorrentFile fills the empty metadata fields of m from a .torrent file.
+// Clients do not report the source field of the info dictionary, so the file
+// is the only place to find it.
+func (m *TorrentMeta) ReadTorrentFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	value, _, err := decodeBencode(data, 0)
+	if err != nil {
+		return fmt.Errorf("invalid torrent file %s: %v", path, err)
+	}
+	root, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid torrent file %s: not a dictionary", path)
+	}
+
+	fill := func(field *string, value interface{}) {
+		if text, ok := value.(string); ok && *field == "" {
+			*field = text
+		}
+	}
+	fill(&m.Comment, root["comment"])
+	fill(&m.CreatedBy, root["created by"])
+	if info, ok := root["info"].(map[string]interface{}); ok {
+		fill(&m.Source, info["source"])
+	}
+	return nil
+}
+
+// decodeBencode decodes the value starting at pos and returns it together with
+// the position after it. Strings are returned as string, integers as int64.
+func decodeBencode(data []byte, pos int) (interface{}, int, error) {
+	if pos >= len(data) {
+		return nil, pos, fmt.Errorf("unexpected end of data")
+	}
+	switch c := data[pos]; {
+	case c == 'i':
+		end := bytes.IndexByte(data[pos:], 'e') + pos
+		if end < pos {
+			return nil, pos, fmt.Errorf("unterminated integer at %d", pos)
+		}
+		n, err := strconv.ParseInt(string(data[pos+1:end]), 10, 64)
+		return n, end + 1, err
+	case c == 'l':
+		var list []interface{}
+		pos++
+		for pos < len(data) && data[pos] != 'e' {
+			item, next, err := decodeBencode(data, pos)
+			if err != nil {
+				return nil, pos, err
+			}
+			list = append(list, item)
+			pos = next
+		}
+		if pos >= len(data) {
+			return nil, pos, fmt.Errorf("unexpected end of data")
+		}
+		return list, pos + 1, nil
+	case c == 'd':
+		dict := make(map[string]interface{})
+		pos++
+		for pos < len(data) && data[pos] != 'e' {
+			key, next, err := decodeBencode(data, pos)
+			if err != nil {
+				return nil, pos, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, pos, fmt.Errorf("dictionary key at %d is not a string", pos)
+			}
+			value, next, err := decodeBencode(data, next)
+			if err != nil {
+				return nil, pos, err
+			}
+			dict[keyString] = value
+			pos = next
+		}
+		if pos >= len(data) {
+			return nil, pos, fmt.Errorf("unexpected end of data")
+		}
+		return dict, pos + 1, nil
+	case c >= '0' && c <= '9':
+		colon := bytes.IndexByte(data[pos:], ':') + pos
+		if colon < pos {
+			return nil, pos, fmt.Errorf("unterminated string length at %d", pos)
+		}
+		length, err := strconv.Atoi(string(data[pos:colon]))
+		if err != nil || length < 0 || length > len(data)-colon-1 {
+			return nil, pos, fmt.Errorf("invalid string length at %d", pos)
+		}
+		return string(data[colon+1 : colon+1+length]), colon + 1 + length, nil
+	default:
+		return nil, pos, fmt.Errorf("unexpected byte %q at %d", c, pos)
+	}
+}
@@ -0,0 +1,103 @@
+package u2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeBencode(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		value interface{}
+		next  int
+	}{
+		{"integer", "i42e", int64(42), 4},
+		{"negative integer", "i-7e", int64(-7), 4},
+		{"string", "4:spam", "spam", 6},
+		{"empty string", "0:", "", 2},
+		{"list", "l4:spami1ee", []interface{}{"spam", int64(1)}, 11},
+		{"dictionary", "d3:cow3:moo4:spaml1:aee", map[string]interface{}{"cow": "moo", "spam": []interface{}{"a"}}, 23},
+		{"trailing data", "i1eXYZ", int64(1), 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, next, err := decodeBencode([]byte(test.data), 0)
+			if err != nil {
+				t.Fatalf("decodeBencode(%q): %v", test.data, err)
+			}
+			if !reflect.DeepEqual(value, test.value) || next != test.next {
+				t.Errorf("decodeBencode(%q) = %#v, %d, want %#v, %d", test.data, value, next, test.value, test.next)
+			}
+		})
+	}
+}
+
+func TestDecodeBencodeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"unknown type", "x"},
+		{"integer without end", "i42"},
+		{"integer not a number", "iabce"},
+		{"empty integer", "ie"},
+		{"string without colon", "4spam"},
+		{"truncated string", "10:spam"},
+		{"negative string length", "-1:a"},
+		{"overflowing string length", "9223372036854775807:a"},
+		{"list without end", "l4:spam"},
+		{"truncated list item", "l4:spa"},
+		{"dictionary without end", "d3:cow3:moo"},
+		{"dictionary without value", "d3:cowe"},
+		{"integer dictionary key", "di1e3:mooe"},
+		{"truncated dictionary value", "d3:cowl"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if value, _, err := decodeBencode([]byte(test.data), 0); err == nil {
+				t.Errorf("decodeBencode(%q) = %#v, want an error", test.data, value)
+			}
+		})
+	}
+}
+
+func writeTorrentFile(t *testing.T, data string) string {
+	dir, err := ioutil.TempDir("", "torrentfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "test.torrent")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadTorrentFile(t *testing.T) {
+	path := writeTorrentFile(t, "d7:comment4:note10:created by6:client4:infod4:name1:a6:source2:U2ee")
+	meta := TorrentMeta{Comment: "kept"}
+	if err := meta.ReadTorrentFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Comment != "kept" || meta.CreatedBy != "client" || meta.Source != "U2" {
+		t.Errorf("ReadTorrentFile filled %+v", meta)
+	}
+}
+
+func TestReadTorrentFileInvalid(t *testing.T) {
+	for _, data := range []string{"", "d7:comment4:no", "l4:spame", "i1e"} {
+		meta := TorrentMeta{}
+		if err := meta.ReadTorrentFile(writeTorrentFile(t, data)); err == nil {
+			t.Errorf("ReadTorrentFile(%q) = nil, want an error", data)
+		}
+		if meta.Comment != "" || meta.CreatedBy != "" || meta.Source != "" {
+			t.Errorf("ReadTorrentFile(%q) filled %+v", data, meta)
+		}
+	}
+}
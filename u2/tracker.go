@@ -0,0 +1,117 @@
+package u2
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// defaultTrackerPattern keeps the historical behavior of matching any
+// announce URL containing "dmhy" when no rule is configured.
+const defaultTrackerPattern = "dmhy"
+
+// DefaultKeyErrorPattern matches the announce errors of an unregistered
+// torrent and of a bad passkey or secure key. Connection errors and other
+// tracker errors do not match, a new key would not fix them.
+const DefaultKeyErrorPattern = `(?i)unregistered|not registered|(invalid|wrong|unknown) (passkey|secure)|(passkey|secure( key)?) (is )?(invalid|wrong|unknown)`
+
+type TrackerRules struct {
+	Hosts    []string
+	Patterns []string
+	Exclude  []string
+}
+
+func (r *TrackerRules) Validate() error {
+	_, err := NewTrackerMatcher(*r)
+	return err
+}
+
+// TrackerMatcher decides whether an announce URL belongs to U2. A URL matches
+// when its host is one of Hosts or a subdomain of it, or when it matches one of
+// Patterns, and it matches none of Exclude.
+type TrackerMatcher struct {
+	hosts    []string
+	patterns []*regexp.Regexp
+	exclude  []*regexp.Regexp
+}
+
+func NewTrackerMatcher(rules TrackerRules) (*TrackerMatcher, error) {
+	matcher := &TrackerMatcher{}
+	for _, host := range rules.Hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host != "" {
+			matcher.hosts = append(matcher.hosts, host)
+		}
+	}
+
+	patterns := rules.Patterns
+	if len(matcher.hosts) == 0 && len(patterns) == 0 {
+		patterns = []string{defaultTrackerPattern}
+	}
+	var err error
+	if matcher.patterns, err = compilePatterns(patterns); err != nil {
+		return nil, err
+	}
+	if matcher.exclude, err = compilePatterns(rules.Exclude); err != nil {
+		return nil, err
+	}
+	return matcher, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func (m *TrackerMatcher) Match(announce string) bool {
+	for _, re := range m.exclude {
+		if re.MatchString(announce) {
+			return false
+		}
+	}
+	if len(m.hosts) > 0 {
+		if announceUrl, err := url.Parse(announce); err == nil {
+			host := strings.ToLower(announceUrl.Hostname())
+			for _, matchHost := range m.hosts {
+				if host == matchHost || strings.HasSuffix(host, "."+matchHost) {
+					return true
+				}
+			}
+		}
+	}
+	for _, re := range m.patterns {
+		if re.MatchString(announce) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyErrorMatcher compiles pattern, DefaultKeyErrorPattern when empty.
+func KeyErrorMatcher(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = DefaultKeyErrorPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// HasKeyError tells whether the last announce of the U2 tracker failed with a
+// message matching keyError.
+func (t *Torrent) HasKeyError(keyError *regexp.Regexp) bool {
+	return t.TrackerFailed && keyError.MatchString(t.TrackerMessage)
+}
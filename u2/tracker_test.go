@@ -0,0 +1,34 @@
+package u2
+
+import "testing"
+
+func TestDefaultKeyErrorPattern(t *testing.T) {
+	keyError, err := KeyErrorMatcher("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		message string
+		match   bool
+	}{
+		{"Invalid passkey! Re-download the .torrent from U2", true},
+		{"Error: invalid passkey", true},
+		{"Passkey is invalid", true},
+		{"Invalid secure key", true},
+		{"secure invalid", true},
+		{"Wrong passkey", true},
+		{"404 (Not Found)", false},
+		{"Tracker gave HTTP response code 404 (Not Found)", false},
+		{"invalid response", false},
+		{"Could not connect to tracker", false},
+		{"Torrent not registered with this tracker", true},
+		{"Unregistered torrent", true},
+		{"Error: unregistered torrent", true},
+		{"timed out", false},
+	}
+	for _, test := range tests {
+		if match := keyError.MatchString(test.message); match != test.match {
+			t.Errorf("match %q = %v, want %v", test.message, match, test.match)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package u2test is a mock of the U2 JSON-RPC key API for development and
+// integration tests, see cmd/mock-u2 for a standalone server.
+package u2test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors per info hash, answered instead of a key. U2 does not document how
+// it reports a deleted torrent or a rate limit per torrent. NotFoundError and
+// RateLimitedError are guesses in the server error range, which the client
+// only tells apart by their message. InvalidParamsError has the same message
+// as NotFoundError but a standard code, which decides over the message.
+var (
+	NotFoundError      = u2.U2Error{Code: -32001, Message: "torrent not found"}
+	RateLimitedError   = u2.U2Error{Code: -32000, Message: "rate limit exceeded"}
+	InvalidParamsError = u2.U2Error{Code: u2.CodeInvalidParams, Message: "torrent not found"}
+)
+
+// Config chooses how the mock misbehaves. The zero value answers every query
+// with Key of its hash.
+type Config struct {
+	// ApiKey is the only key accepted, from the query, the X-Api-Key header or
+	// the request body. Empty accepts any key.
+	ApiKey string
+
+	// Unavailable answers the first requests with 503 and RateLimited the
+	// requests after them with 429, both with RetryAfter in Retry-After.
+	Unavailable int
+	RateLimited int
+	RetryAfter  time.Duration
+
+	// Errors answers these info hashes, in any case, with an error instead of
+	// a key.
+	Errors map[string]u2.U2Error
+
+	// Shuffle returns the responses of a batch out of order, Drop leaves out
+	// every Drop-th response and Extra adds a response with an unknown id.
+	Shuffle bool
+	Drop    int
+	Extra   bool
+
+	// Delay is waited before each response.
+	Delay time.Duration
+
+	// MaxBatchSize rejects larger batches with an invalid request error. It
+	// is not advertised, the client has to shrink on the error.
+	MaxBatchSize int
+
+	// BatchError answers every batch with this single error object instead
+	// of an array.
+	BatchError *u2.U2Error
+}
+
+// Key returns the deterministic key the mock gives to hash.
+func Key(hash string) string {
+	sum := sha1.Sum([]byte("u2test:" + strings.ToLower(hash)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Handler serves the batch query method of jsonrpc_torrentkey.php.
+type Handler struct {
+	config   Config
+	mu       sync.Mutex
+	requests int
+	random   *rand.Rand
+}
+
+func NewHandler(config Config) *Handler {
+	errors := make(map[string]u2.U2Error, len(config.Errors))
+	for hash, u2Error := range config.Errors {
+		errors[strings.ToLower(hash)] = u2Error
+	}
+	config.Errors = errors
+	return &Handler{config: config, random: rand.New(rand.NewSource(1))}
+}
+
+// NewServer starts a mock on a local port, use its URL as u2.Config.ApiUrl.
+func NewServer(config Config) *httptest.Server {
+	return httptest.NewServer(NewHandler(config))
+}
+
+// Requests returns the number of requests served so far.
+func (h *Handler) Requests() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.requests
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.requests++
+	count := h.requests
+	h.mu.Unlock()
+
+	if h.config.Delay > 0 {
+		time.Sleep(h.config.Delay)
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if count <= h.config.Unavailable+h.config.RateLimited {
+		if h.config.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(h.config.RetryAfter/time.Second)))
+		}
+		status := http.StatusServiceUnavailable
+		if count > h.config.Unavailable {
+			status = http.StatusTooManyRequests
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var requests []u2.U2Request
+	if err := json.Unmarshal(body, &requests); err != nil {
+		writeJson(w, u2.U2Response{JsonRpc: "2.0", Error: &u2.U2Error{Code: u2.CodeParseError, Message: "Parse error"}})
+		return
+	}
+	if !h.authorized(r, requests) {
+		http.Error(w, "invalid api key", http.StatusForbidden)
+		return
+	}
+	if h.config.BatchError != nil {
+		writeJson(w, u2.U2Response{JsonRpc: "2.0", Error: h.config.BatchError})
+		return
+	}
+	if h.config.MaxBatchSize > 0 && len(requests) > h.config.MaxBatchSize {
+		message := fmt.Sprintf("batch of %d is larger than %d", len(requests), h.config.MaxBatchSize)
+		writeJson(w, u2.U2Response{JsonRpc: "2.0", Error: &u2.U2Error{Code: u2.CodeInvalidRequest, Message: message}})
+		return
+	}
+
+	responses := make([]u2.U2Response, 0, len(requests)+1)
+	for i, request := range requests {
+		if h.config.Drop > 0 && (i+1)%h.config.Drop == 0 {
+			continue
+		}
+		responses = append(responses, h.answer(request))
+	}
+	if h.config.Shuffle {
+		h.mu.Lock()
+		h.random.Shuffle(len(responses), func(i, j int) {
+			responses[i], responses[j] = responses[j], responses[i]
+		})
+		h.mu.Unlock()
+	}
+	if h.config.Extra {
+		id := len(requests) + 1000
+		responses = append(responses, u2.U2Response{JsonRpc: "2.0", Id: &id, Result: json.RawMessage(`"unexpected"`)})
+	}
+	writeJson(w, responses)
+}
+
+func (h *Handler) authorized(r *http.Request, requests []u2.U2Request) bool {
+	if h.config.ApiKey == "" {
+		return true
+	}
+	if r.URL.Query().Get("apikey") == h.config.ApiKey || r.Header.Get("X-Api-Key") == h.config.ApiKey {
+		return true
+	}
+	return len(requests) > 0 && requests[0].ApiKey == h.config.ApiKey
+}
+
+func (h *Handler) answer(request u2.U2Request) u2.U2Response {
+	id := request.Id
+	response := u2.U2Response{JsonRpc: "2.0", Id: &id}
+	switch {
+	case request.Method != "query":
+		response.Error = &u2.U2Error{Code: u2.CodeMethodNotFound, Message: "Method not found"}
+	case len(request.Params) != 1:
+		response.Error = &u2.U2Error{Code: u2.CodeInvalidParams, Message: "Invalid params"}
+	default:
+		hash := strings.ToLower(request.Params[0])
+		if u2Error, ok := h.config.Errors[hash]; ok {
+			response.Error = &u2Error
+		} else {
+			response.Result, _ = json.Marshal(Key(hash))
+		}
+	}
+	return response
+}
+
+func writeJson(w http.ResponseWriter, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
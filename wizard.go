@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/i0range/U2KeyResetTool/tool"
+	"github.com/i0range/U2KeyResetTool/u2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func runWizard(reader *bufio.Reader, previous *u2.Config) *u2.Config {
+	for {
+		config := askConfig(reader, previous)
+		config.Normalize()
+		if errs := config.Validate(); len(errs) > 0 {
+			tool.PrintValidationErrors(errs)
+			fmt.Println("Please input again.")
+			previous = config
+			continue
+		}
+
+		fmt.Printf("Testing connection to %s...\n", config.Target)
+		err := tool.TestConnection(config)
+		if err == nil {
+			fmt.Println("Connection test passed!")
+			return config
+		}
+
+		fmt.Println("Connection test failed!")
+		fmt.Println(err)
+		if !askBool(reader, "Edit your answers?", true) {
+			return config
+		}
+		previous = config
+	}
+}
+
+func askConfig(reader *bufio.Reader, previous *u2.Config) *u2.Config {
+	if previous == nil {
+		previous = &u2.Config{Target: "transmission", Host: "127.0.0.1"}
+	}
+
+	fmt.Println("t for Transmission, q for qBittorrent, d for Deluge")
+	target := askValue(reader, "Target program (t/q/d)", previous.Target, func(value string) (string, error) {
+		target := tool.ParseTarget(value)
+		return target, u2.ValidateTarget(target)
+	})
+
+	host := askValue(reader, "Host or connection URL", previous.Host, func(value string) (string, error) {
+		if !strings.Contains(value, "://") {
+			return value, u2.ValidateHost(value)
+		}
+		urlConfig, err := u2.ParseConnectionUrl(value, target)
+		if err != nil {
+			return value, err
+		}
+		// Only the connection comes from the URL, the rest stays as saved.
+		merged := *previous
+		merged.Target = urlConfig.Target
+		merged.Host = urlConfig.Host
+		merged.Port = urlConfig.Port
+		merged.Secure = urlConfig.Secure
+		merged.BasePath = urlConfig.BasePath
+		merged.User = urlConfig.User
+		if urlConfig.Pass != "" {
+			merged.Pass = urlConfig.Pass
+		}
+		previous = &merged
+		target = urlConfig.Target
+		return urlConfig.Host, u2.ValidateHost(urlConfig.Host)
+	})
+
+	defaultPort := u2.DefaultPort(target)
+	if previous.Target == target && previous.Port != 0 {
+		defaultPort = previous.Port
+	}
+	portString := askValue(reader, "Port", strconv.Itoa(int(defaultPort)), func(value string) (string, error) {
+		port, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return value, fmt.Errorf("port %q is not a number", value)
+		}
+		return value, u2.ValidatePort(port)
+	})
+	port, _ := strconv.ParseUint(portString, 10, 16)
+
+	https := askBool(reader, "Use https", previous.Secure)
+
+	basePath := ""
+	if target != "deluge" {
+		defaultBasePath := previous.BasePath
+		if defaultBasePath == "" {
+			defaultBasePath = "/"
+		}
+		fmt.Println("Base path is the path in the WebUI URL, e.g. /qbit/ behind a reverse proxy. For Transmission it is the rpc-url, /transmission/ by default.")
+		basePath = askValue(reader, "Base path", defaultBasePath, nil)
+	}
+
+	user := askValue(reader, "User", previous.User, nil)
+
+	pass := previous.Pass
+	if pass != "" {
+		fmt.Print("Password (leave empty to keep current) []: ")
+	} else {
+		fmt.Print("Password []: ")
+	}
+	if newPass := tool.ReadPassword(reader); newPass != "" {
+		pass = newPass
+	}
+
+	tlsConfig := previous.TLS
+	if https || target == "deluge" {
+		address := (&u2.Config{Host: host, Port: uint16(port)}).Address()
+		tlsConfig = askTLSConfig(reader, address, previous.TLS)
+	}
+
+	apiKey := askValue(reader, "API Key (Get From https://u2.dmhy.org/privatetorrents.php)", previous.ApiKey, func(value string) (string, error) {
+		apiKey := u2.NormalizeApiKey(value)
+		return apiKey, u2.ValidateApiKey(apiKey)
+	})
+
+	fmt.Println("Proxies accept http://, https:// and socks5://user:pass@ URLs. Leave empty to use HTTP(S)_PROXY and NO_PROXY, or enter \"direct\" to ignore them.")
+	proxy := askValue(reader, "Proxy for U2 API (May need to access U2 API, e.g. socks5://127.0.0.1:1080)", previous.Proxy, func(value string) (string, error) {
+		return value, u2.ValidateProxy(value)
+	})
+
+	clientProxy := ""
+	if target != "deluge" {
+		clientProxy = askValue(reader, "Proxy for torrent client", previous.ClientProxy, func(value string) (string, error) {
+			return value, u2.ValidateProxy(value)
+		})
+	}
+
+	announce := previous.Announce
+	announce.Host = askTrackerHost(reader, previous.Announce)
+
+	return &u2.Config{
+		Target:      target,
+		Host:        host,
+		Port:        uint16(port),
+		Secure:      https,
+		BasePath:    basePath,
+		User:        user,
+		Pass:        pass,
+		ApiKey:      apiKey,
+		ApiUrl:      previous.ApiUrl,
+		ApiKeyIn:    previous.ApiKeyIn,
+		Proxy:       proxy,
+		ClientProxy: clientProxy,
+		TLS:         tlsConfig,
+		ApiTLS:      previous.ApiTLS,
+
+		TrackerRules: previous.TrackerRules,
+		Metadata:     previous.Metadata,
+		Announce:     announce,
+		RateLimit:    previous.RateLimit,
+		Retry:        previous.Retry,
+		Batch:        previous.Batch,
+		Budget:       previous.Budget,
+		Cache:        previous.Cache,
+	}
+}
+
+func askTrackerHost(reader *bufio.Reader, previous u2.AnnounceConfig) string {
+	fmt.Println("Known U2 tracker hosts:")
+	for i, host := range u2.KnownTrackerHosts {
+		fmt.Printf("%d) %s\n", i+1, host)
+	}
+	defaultHost := previous.Host
+	if defaultHost == "" {
+		defaultHost = u2.KnownTrackerHosts[0]
+	}
+	return askValue(reader, "Tracker host written to torrents (number or host name)", defaultHost, func(value string) (string, error) {
+		if index, err := strconv.Atoi(value); err == nil {
+			if index < 1 || index > len(u2.KnownTrackerHosts) {
+				return value, fmt.Errorf("please choose between 1 and %d", len(u2.KnownTrackerHosts))
+			}
+			value = u2.KnownTrackerHosts[index-1]
+		}
+		announce := previous
+		announce.Host = value
+		return value, announce.Validate()
+	})
+}
+
+func askTLSConfig(reader *bufio.Reader, address string, previous u2.TLSConfig) u2.TLSConfig {
+	if !askBool(reader, "Configure certificate options (self-signed certificate, custom CA, client certificate)?", !previous.IsZero()) {
+		return previous
+	}
+
+	if fingerprint, err := u2.FetchFingerprint(address, 5*time.Second); err == nil {
+		fmt.Printf("Server certificate fingerprint (SHA-256): %s\n", fingerprint)
+	}
+	tlsConfig := u2.TLSConfig{}
+	tlsConfig.Fingerprint = askValue(reader, "Pin certificate fingerprint (paste the value above to trust it)", previous.Fingerprint, func(value string) (string, error) {
+		checked := u2.TLSConfig{Fingerprint: u2.NormalizeFingerprint(value)}
+		return checked.Fingerprint, checked.Validate()
+	})
+	tlsConfig.CaFile = askValue(reader, "CA bundle file", previous.CaFile, func(value string) (string, error) {
+		return value, (&u2.TLSConfig{CaFile: value}).Validate()
+	})
+	tlsConfig.Insecure = askBool(reader, "Skip certificate verification (insecure)", previous.Insecure)
+	tlsConfig.CertFile = askValue(reader, "Client certificate file", previous.CertFile, nil)
+	if tlsConfig.CertFile != "" {
+		tlsConfig.KeyFile = askValue(reader, "Client key file", previous.KeyFile, func(value string) (string, error) {
+			return value, (&u2.TLSConfig{CertFile: tlsConfig.CertFile, KeyFile: value}).Validate()
+		})
+	}
+	return tlsConfig
+}
+
+// askValue prompts until check accepts the answer. An empty answer selects
+// defaultValue, and check may rewrite the answer into its canonical form.
+func askValue(reader *bufio.Reader, label string, defaultValue string, check func(string) (string, error)) string {
+	for {
+		fmt.Printf("%s [%s]: ", label, defaultValue)
+		value, readErr := reader.ReadString('\n')
+		value = strings.TrimSpace(value)
+		if value == "" {
+			value = defaultValue
+		}
+		if check == nil {
+			return value
+		}
+
+		checked, err := check(value)
+		if err == nil {
+			return checked
+		}
+		fmt.Println(err)
+		if readErr != nil {
+			panic(readErr)
+		}
+	}
+}
+
+func askBool(reader *bufio.Reader, label string, defaultValue bool) bool {
+	hint := "y/N"
+	if defaultValue {
+		hint = "Y/n"
+	}
+	for {
+		fmt.Printf("%s (%s): ", label, hint)
+		value, readErr := reader.ReadString('\n')
+		value = strings.ToLower(strings.TrimSpace(value))
+		switch value {
+		case "":
+			return defaultValue
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		fmt.Println("Please answer y or n.")
+		if readErr != nil {
+			return defaultValue
+		}
+	}
+}